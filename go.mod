@@ -5,6 +5,7 @@ go 1.25.5
 require (
 	github.com/tliron/glsp v0.2.2
 	github.com/vektah/gqlparser/v2 v2.5.31
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 replace github.com/tliron/glsp => github.com/skaji/glsp v0.0.0-20260107192625-dd9435c01989
@@ -9,8 +9,10 @@ import (
 )
 
 type builtinCache struct {
-	once    sync.Once
-	scalars map[string]struct{}
+	once       sync.Once
+	scalars    map[string]struct{}
+	directives map[string]struct{}
+	prelude    *ast.SchemaDocument
 }
 
 var builtins builtinCache
@@ -18,10 +20,15 @@ var builtins builtinCache
 func ensureBuiltinsLoaded() {
 	builtins.once.Do(func() {
 		builtins.scalars = make(map[string]struct{})
+		builtins.directives = make(map[string]struct{})
 		doc, err := parser.ParseSchema(validator.Prelude)
 		if err != nil || doc == nil {
 			return
 		}
+		builtins.prelude = doc
+		for _, directive := range doc.Directives {
+			builtins.directives[directive.Name] = struct{}{}
+		}
 		for _, def := range doc.Definitions {
 			if def == nil {
 				continue
@@ -41,3 +48,19 @@ func isBuiltInScalar(name string) bool {
 	_, ok := builtins.scalars[name]
 	return ok
 }
+
+// preludeDocument returns the parsed built-in definitions every schema is
+// loaded with.
+func preludeDocument() *ast.SchemaDocument {
+	ensureBuiltinsLoaded()
+	return builtins.prelude
+}
+
+func isBuiltInDirective(name string) bool {
+	if name == "" {
+		return false
+	}
+	ensureBuiltinsLoaded()
+	_, ok := builtins.directives[name]
+	return ok
+}
@@ -10,15 +10,17 @@ import (
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/lexer"
 	"github.com/vektah/gqlparser/v2/parser"
 )
 
 func (s *Server) completion(_ *glsp.Context, params *protocol.CompletionParams) (any, error) {
 	uri := params.TextDocument.URI
+	if isIntrospectionURI(uri) {
+		return nil, nil
+	}
 
-	s.state.mu.Lock()
-	schema := s.state.schema
-	s.state.mu.Unlock()
+	schema := s.schemaForURI(uri)
 	if schema == nil {
 		slog.Debug("completion: schema not loaded", "uri", uri)
 		return nil, nil
@@ -58,19 +60,39 @@ func (s *Server) completion(_ *glsp.Context, params *protocol.CompletionParams)
 		return nil, nil
 	}
 
+	if shouldCompleteVariableType(uri, text, offset) {
+		items := inputTypeCompletionItems(schema)
+		slog.Debug("completion: variable type items", "uri", uri, "count", len(items))
+		return items, nil
+	}
+
+	if items, ok := argumentCompletionItems(uri, text, offset, schema); ok {
+		slog.Debug("completion: argument items", "uri", uri, "count", len(items))
+		return items, nil
+	}
+
 	if shouldCompleteTypeCondition(text, offset) {
 		items := typeCompletionItems(schema)
 		slog.Debug("completion: type condition items", "uri", uri, "count", len(items))
 		return items, nil
 	}
 
-	doc, err := parser.ParseQuery(&ast.Source{
+	if items, ok := s.fragmentSpreadCompletionItems(uri, text, offset, schema); ok {
+		slog.Debug("completion: fragment spread items", "uri", uri, "count", len(items))
+		return items, nil
+	}
+
+	source := &ast.Source{
 		Name:  string(uri),
 		Input: text,
-	})
+	}
+	doc, err := parser.ParseQuery(source)
 	if err != nil {
-		slog.Debug("completion: parse error", "uri", uri, "error", err)
-		return nil, nil
+		slog.Debug("completion: parse error; using tokens", "uri", uri, "error", err)
+		parent := findCompletionParentTypeFromTokens(newSymbolTokens(source), schema, offset)
+		items := fieldCompletionItems(parent, schema)
+		slog.Debug("completion: field items", "uri", uri, "count", len(items))
+		return items, nil
 	}
 
 	parent := findCompletionParentType(doc, schema, text, offset)
@@ -115,6 +137,23 @@ func typeCompletionItems(schema *ast.Schema) []protocol.CompletionItem {
 	return items
 }
 
+// inputTypeCompletionItems returns the scalars, enums, and input objects
+// that variables may be declared with.
+func inputTypeCompletionItems(schema *ast.Schema) []protocol.CompletionItem {
+	items := make([]protocol.CompletionItem, 0, len(schema.Types))
+	for name, def := range schema.Types {
+		if def == nil || !def.IsInputType() || strings.HasPrefix(name, "__") {
+			continue
+		}
+		kind := completionKindForDefinition(def)
+		items = append(items, protocol.CompletionItem{
+			Label: name,
+			Kind:  &kind,
+		})
+	}
+	return items
+}
+
 func unionTypeCompletionItems(schema *ast.Schema) []protocol.CompletionItem {
 	if schema == nil {
 		return nil
@@ -205,11 +244,6 @@ func findCompletionParentType(doc *ast.QueryDocument, schema *ast.Schema, text s
 		return nil
 	}
 
-	fragments := make(map[string]*ast.FragmentDefinition, len(doc.Fragments))
-	for _, fragment := range doc.Fragments {
-		fragments[fragment.Name] = fragment
-	}
-
 	for _, op := range doc.Operations {
 		root := rootTypeForOperation(schema, op.Operation)
 		if root == nil {
@@ -218,13 +252,23 @@ func findCompletionParentType(doc *ast.QueryDocument, schema *ast.Schema, text s
 		if !selectionSetContainsOffset(text, op.Position, offset) {
 			continue
 		}
-		return findParentTypeInSelectionSet(op.SelectionSet, schema, root, fragments, text, offset)
+		return findParentTypeInSelectionSet(op.SelectionSet, schema, root, text, offset)
+	}
+	for _, fragment := range doc.Fragments {
+		root := schema.Types[fragment.TypeCondition]
+		if root == nil {
+			continue
+		}
+		if !selectionSetContainsOffset(text, fragment.Position, offset) {
+			continue
+		}
+		return findParentTypeInSelectionSet(fragment.SelectionSet, schema, root, text, offset)
 	}
 
 	return nil
 }
 
-func findParentTypeInSelectionSet(set ast.SelectionSet, schema *ast.Schema, parent *ast.Definition, fragments map[string]*ast.FragmentDefinition, text string, offset int) *ast.Definition {
+func findParentTypeInSelectionSet(set ast.SelectionSet, schema *ast.Schema, parent *ast.Definition, text string, offset int) *ast.Definition {
 	if parent == nil {
 		return nil
 	}
@@ -243,7 +287,7 @@ func findParentTypeInSelectionSet(set ast.SelectionSet, schema *ast.Schema, pare
 			if nextParent == nil {
 				return parent
 			}
-			nested := findParentTypeInSelectionSet(sel.SelectionSet, schema, nextParent, fragments, text, offset)
+			nested := findParentTypeInSelectionSet(sel.SelectionSet, schema, nextParent, text, offset)
 			if nested != nil {
 				return nested
 			}
@@ -258,33 +302,116 @@ func findParentTypeInSelectionSet(set ast.SelectionSet, schema *ast.Schema, pare
 					nextParent = def
 				}
 			}
-			nested := findParentTypeInSelectionSet(sel.SelectionSet, schema, nextParent, fragments, text, offset)
+			nested := findParentTypeInSelectionSet(sel.SelectionSet, schema, nextParent, text, offset)
 			if nested != nil {
 				return nested
 			}
 			return nextParent
-		case *ast.FragmentSpread:
-			fragment := fragments[sel.Name]
-			if fragment == nil || !selectionSetContainsOffset(text, fragment.Position, offset) {
+		}
+	}
+
+	return parent
+}
+
+// findCompletionParentTypeFromTokens finds the type whose fields may be
+// selected at the rune offset from the brackets before it, for documents
+// that do not parse while a selection is being written.
+func findCompletionParentTypeFromTokens(t *symbolTokens, schema *ast.Schema, offset int) *ast.Definition {
+	last, _ := t.beforeCursor(offset)
+	// opens holds the unclosed selection sets, innermost first.
+	var opens []int
+	depth := 0
+	for i := last; i >= 0; i-- {
+		switch t.tokens[i].Kind {
+		case lexer.BraceR, lexer.ParenR, lexer.BracketR:
+			depth++
+		case lexer.BraceL, lexer.ParenL, lexer.BracketL:
+			if depth > 0 {
+				depth--
 				continue
 			}
-			nextParent := parent
-			if fragment.TypeCondition != "" {
-				if def := schema.Types[fragment.TypeCondition]; def != nil {
-					nextParent = def
-				}
+			if t.tokens[i].Kind != lexer.BraceL {
+				return nil
 			}
-			nested := findParentTypeInSelectionSet(fragment.SelectionSet, schema, nextParent, fragments, text, offset)
-			if nested != nil {
-				return nested
-			}
-			return nextParent
+			opens = append(opens, i)
+		}
+	}
+	if len(opens) == 0 {
+		return nil
+	}
+	var parent *ast.Definition
+	for k := len(opens) - 1; k >= 0; k-- {
+		j := skipDirectivesBefore(t, opens[k]-1)
+		if k == len(opens)-1 {
+			parent = definitionRootType(t, schema, j)
+		} else {
+			parent = selectionSetType(t, schema, parent, j)
+		}
+		if parent == nil {
+			return nil
 		}
 	}
-
 	return parent
 }
 
+// skipDirectivesBefore returns the index of the last token at or before j
+// that is not part of a directive or an argument list.
+func skipDirectivesBefore(t *symbolTokens, j int) int {
+	for {
+		switch {
+		case t.kindAt(j) == lexer.ParenR:
+			j = t.opening(j) - 1
+		case t.kindAt(j) == lexer.Name && t.kindAt(j-1) == lexer.At:
+			j -= 2
+		default:
+			return j
+		}
+	}
+}
+
+// definitionRootType returns the type selected by the top-level definition
+// whose header ends with token j.
+func definitionRootType(t *symbolTokens, schema *ast.Schema, j int) *ast.Definition {
+	switch {
+	case j < 0 || t.kindAt(j) == lexer.BraceR:
+		return schema.Query
+	case t.kindAt(j) != lexer.Name:
+		return nil
+	case t.isName(j-1, "on"):
+		return schema.Types[t.tokens[j].Value]
+	}
+	if t.kindAt(j-1) == lexer.Name {
+		j--
+	}
+	switch t.tokens[j].Value {
+	case "query":
+		return schema.Query
+	case "mutation":
+		return schema.Mutation
+	case "subscription":
+		return schema.Subscription
+	}
+	return nil
+}
+
+// selectionSetType returns the type selected by the selection set opened
+// after token j within a selection set of parent.
+func selectionSetType(t *symbolTokens, schema *ast.Schema, parent *ast.Definition, j int) *ast.Definition {
+	switch {
+	case t.kindAt(j) == lexer.Spread:
+		return parent
+	case t.kindAt(j) != lexer.Name:
+		return nil
+	case t.isName(j-1, "on") && t.kindAt(j-2) == lexer.Spread:
+		return schema.Types[t.tokens[j].Value]
+	}
+	def := findFieldDefinition(parent, t.tokens[j].Value)
+	if def == nil {
+		return nil
+	}
+	return schema.Types[def.Type.Name()]
+}
+
 func selectionSetContainsOffset(text string, pos *ast.Position, offset int) bool {
 	if pos == nil {
 		return false
@@ -312,6 +439,8 @@ func selectionSetRange(runes []rune, start int) (int, int, bool) {
 }
 
 func scanToOpenBrace(runes []rune, start int) (int, bool) {
+	// Braces of object values in argument lists do not open a selection set.
+	parenDepth := 0
 	inString := false
 	inBlockString := false
 	inComment := false
@@ -353,8 +482,15 @@ func scanToOpenBrace(runes []rune, start int) (int, bool) {
 			}
 			continue
 		}
-		if r == '{' {
-			return i, true
+		switch r {
+		case '(':
+			parenDepth++
+		case ')':
+			parenDepth--
+		case '{':
+			if parenDepth <= 0 {
+				return i, true
+			}
 		}
 	}
 	return 0, false
@@ -440,8 +576,9 @@ func shouldCompleteTypeCondition(text string, offset int) bool {
 		return false
 	}
 	idx := strings.LastIndex(trim, "...") + 3
-	rest := strings.TrimSpace(trim[idx:])
-	return strings.HasPrefix(rest, "on")
+	// Only the type condition itself, not a selection set after it.
+	words := strings.Fields(trim[idx:])
+	return len(words) > 0 && len(words) <= 2 && words[0] == "on" && !strings.ContainsAny(trim[idx:], "{}()@")
 }
 
 func shouldCompleteSchemaTypes(text string, offset int) bool {
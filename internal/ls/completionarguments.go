@@ -0,0 +1,547 @@
+package ls
+
+import (
+	"fmt"
+	"strings"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/lexer"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// inputValue is an argument or an input object field.
+type inputValue struct {
+	name         string
+	description  string
+	typ          *ast.Type
+	defaultValue *ast.Value
+}
+
+func argumentInputValues(args ast.ArgumentDefinitionList) []inputValue {
+	values := make([]inputValue, 0, len(args))
+	for _, arg := range args {
+		values = append(values, inputValue{name: arg.Name, description: arg.Description, typ: arg.Type, defaultValue: arg.DefaultValue})
+	}
+	return values
+}
+
+func fieldInputValues(fields ast.FieldList) []inputValue {
+	values := make([]inputValue, 0, len(fields))
+	for _, field := range fields {
+		values = append(values, inputValue{name: field.Name, description: field.Description, typ: field.Type, defaultValue: field.DefaultValue})
+	}
+	return values
+}
+
+func findInputValue(values []inputValue, name string) *inputValue {
+	for i := range values {
+		if values[i].name == name {
+			return &values[i]
+		}
+	}
+	return nil
+}
+
+// argumentContext describes a cursor inside the argument list of a field or
+// directive in an executable document, possibly within object and list
+// values.
+type argumentContext struct {
+	// inputs are the arguments, or the fields of the input object value,
+	// that may be named at the cursor.
+	inputs []inputValue
+	kind   protocol.CompletionItemKind
+	// supplied are the names already given in the list or object.
+	supplied map[string]struct{}
+	// value is set when the cursor is at a value of its type.
+	value *inputValue
+	// variables are the variables in scope at the cursor.
+	variables ast.VariableDefinitionList
+	// prefix is the range of the partial name, including a `$`, being typed.
+	prefix protocol.Range
+	// variableOnly is set when the partial name starts with `$`.
+	variableOnly bool
+}
+
+// argumentCompletionItems returns the argument or input field names, or the
+// values, to suggest when offset is inside the argument list of a field or
+// directive.
+func argumentCompletionItems(uri protocol.DocumentUri, text string, offset int, schema *ast.Schema) ([]protocol.CompletionItem, bool) {
+	ctx := findArgumentContext(uri, text, offset, schema)
+	if ctx == nil {
+		return nil, false
+	}
+	if ctx.value != nil {
+		return argumentValueItems(schema, ctx.value, ctx.variables, ctx.prefix, ctx.variableOnly), true
+	}
+	return inputValueNameItems(ctx.inputs, ctx.supplied, ctx.kind), true
+}
+
+func findArgumentContext(uri protocol.DocumentUri, text string, offset int, schema *ast.Schema) *argumentContext {
+	t := newSymbolTokens(&ast.Source{Name: string(uri), Input: text})
+	last, prefixStart := t.beforeCursor(offset)
+
+	// chain holds the unclosed brackets around the cursor, innermost first,
+	// ending with the parenthesis of the argument list.
+	var chain []int
+	depth := 0
+scan:
+	for i := last; i >= 0; i-- {
+		switch t.tokens[i].Kind {
+		case lexer.ParenR, lexer.BraceR, lexer.BracketR:
+			depth++
+		case lexer.ParenL, lexer.BraceL, lexer.BracketL:
+			if depth > 0 {
+				depth--
+				continue
+			}
+			chain = append(chain, i)
+			if t.tokens[i].Kind == lexer.ParenL {
+				break scan
+			}
+			if t.tokens[i].Kind == lexer.BraceL && !isValueStart(t, i) {
+				// A selection set.
+				return nil
+			}
+		}
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+	open := chain[len(chain)-1]
+	if t.kindAt(open) != lexer.ParenL || t.kindAt(open-1) != lexer.Name {
+		return nil
+	}
+	if isVariableDefinitions(t, open) {
+		return nil
+	}
+	name := t.tokens[open-1].Value
+
+	end := offset
+	if closing := t.closing(open); closing < len(t.tokens) {
+		end = t.tokens[closing].Pos.End
+	}
+	// The document rarely parses while an argument is being typed, so the
+	// argument list is blanked out to find the surrounding selection.
+	runes := []rune(text)
+	for i := t.tokens[open].Pos.Start; i < end && i < len(runes); i++ {
+		if runes[i] != '\n' {
+			runes[i] = ' '
+		}
+	}
+	repaired := string(runes)
+	doc, err := parser.ParseQuery(&ast.Source{Name: string(uri), Input: repaired})
+	if err != nil {
+		doc = nil
+	}
+	nameStart := t.tokens[open-1].Pos.Start
+	variables := variablesInScope(doc, nameStart)
+	if doc == nil {
+		variables = variablesFromTokens(t, text, nameStart)
+	}
+	ctx := &argumentContext{
+		kind:      protocol.CompletionItemKindProperty,
+		variables: variables,
+		prefix:    protocol.Range{Start: t.position(prefixStart), End: t.position(offset)},
+		// The partial name starts with `$` when it is the token after last.
+		variableOnly: t.kindAt(last+1) == lexer.Dollar && t.tokens[last+1].Pos.Start == prefixStart,
+	}
+	if t.kindAt(open-2) == lexer.At {
+		directive := schema.Directives[name]
+		if directive == nil {
+			return nil
+		}
+		ctx.inputs = argumentInputValues(directive.Arguments)
+	} else {
+		var parent *ast.Definition
+		if doc != nil {
+			parent = findCompletionParentType(doc, schema, repaired, nameStart)
+		} else {
+			parent = findCompletionParentTypeFromTokens(t, schema, nameStart)
+		}
+		field := findFieldDefinition(parent, name)
+		if field == nil {
+			return nil
+		}
+		ctx.inputs = argumentInputValues(field.Arguments)
+	}
+
+	// Walk the object and list values from the argument list to the cursor.
+	var typ *ast.Type
+	for k := len(chain) - 2; k >= 0; k-- {
+		opener := chain[k]
+		if t.kindAt(opener-1) == lexer.Colon && t.kindAt(opener-2) == lexer.Name {
+			input := findInputValue(ctx.inputs, t.tokens[opener-2].Value)
+			if input == nil {
+				return nil
+			}
+			typ = input.typ
+		} else if t.kindAt(chain[k+1]) == lexer.BracketL && typ != nil && typ.Elem != nil {
+			typ = typ.Elem
+		} else {
+			return nil
+		}
+		if t.kindAt(opener) == lexer.BracketL {
+			if typ.Elem == nil {
+				return nil
+			}
+			continue
+		}
+		def := schema.Types[typ.Name()]
+		if def == nil || def.Kind != ast.InputObject {
+			return nil
+		}
+		ctx.inputs = fieldInputValues(def.Fields)
+		ctx.kind = protocol.CompletionItemKindField
+	}
+
+	innermost := chain[0]
+	if t.kindAt(innermost) == lexer.BracketL {
+		ctx.value = &inputValue{typ: typ.Elem}
+		return ctx
+	}
+	if t.kindAt(last) == lexer.Colon && t.kindAt(last-1) == lexer.Name && last-1 > innermost {
+		ctx.value = findInputValue(ctx.inputs, t.tokens[last-1].Value)
+		if ctx.value == nil {
+			return nil
+		}
+		return ctx
+	}
+	ctx.supplied = suppliedNames(t, innermost)
+	return ctx
+}
+
+// beforeCursor returns the index of the last token before the rune offset
+// that is not the partial name, or `$` and name, being typed, and the offset
+// where that partial name starts.
+func (t *symbolTokens) beforeCursor(offset int) (int, int) {
+	last := len(t.tokens) - 1
+	for last >= 0 && t.tokens[last].Pos.End > offset {
+		last--
+	}
+	prefixStart := offset
+	if t.kindAt(last) == lexer.Name && t.tokens[last].Pos.End == offset {
+		prefixStart = t.tokens[last].Pos.Start
+		last--
+	}
+	if t.kindAt(last) == lexer.Dollar && t.tokens[last].Pos.End == prefixStart {
+		prefixStart = t.tokens[last].Pos.Start
+		last--
+	}
+	return last, prefixStart
+}
+
+// shouldCompleteVariableType reports whether offset is at the type of a
+// variable definition of an operation.
+func shouldCompleteVariableType(uri protocol.DocumentUri, text string, offset int) bool {
+	t := newSymbolTokens(&ast.Source{Name: string(uri), Input: text})
+	last, _ := t.beforeCursor(offset)
+	// The type follows the colon, possibly inside list brackets.
+	colon := last
+	for t.kindAt(colon) == lexer.BracketL {
+		colon--
+	}
+	if t.kindAt(colon) != lexer.Colon || t.kindAt(colon-1) != lexer.Name || t.kindAt(colon-2) != lexer.Dollar {
+		return false
+	}
+	depth := 0
+	for i := colon - 3; i >= 0; i-- {
+		switch t.tokens[i].Kind {
+		case lexer.ParenR, lexer.BraceR, lexer.BracketR:
+			depth++
+		case lexer.ParenL, lexer.BraceL, lexer.BracketL:
+			if depth == 0 {
+				return t.tokens[i].Kind == lexer.ParenL && isVariableDefinitions(t, i)
+			}
+			depth--
+		}
+	}
+	return false
+}
+
+// isVariableDefinitions reports whether the parenthesis at open starts the
+// variable definitions of an operation.
+func isVariableDefinitions(t *symbolTokens, open int) bool {
+	for _, i := range []int{open - 1, open - 2} {
+		if t.kindAt(i) != lexer.Name {
+			return false
+		}
+		switch t.tokens[i].Value {
+		case "query", "mutation", "subscription":
+			return true
+		}
+	}
+	return false
+}
+
+// variablesFromTokens returns the variables of the operation around the rune
+// offset of a document that does not parse, reading its variable
+// definitions on their own.
+func variablesFromTokens(t *symbolTokens, text string, offset int) ast.VariableDefinitionList {
+	last, _ := t.beforeCursor(offset)
+	outermost := t.outermostOpen(last)
+	if t.kindAt(outermost) != lexer.BraceL {
+		return nil
+	}
+	closing := skipDirectivesAfterVariables(t, outermost-1)
+	if t.kindAt(closing) != lexer.ParenR {
+		return nil
+	}
+	open := t.opening(closing)
+	if !isVariableDefinitions(t, open) {
+		return nil
+	}
+	runes := []rune(text)
+	definitions := string(runes[t.tokens[open].Pos.Start:t.tokens[closing].Pos.End])
+	doc, err := parser.ParseQuery(&ast.Source{Input: "query" + definitions + " { __typename }"})
+	if err != nil || len(doc.Operations) == 0 {
+		return nil
+	}
+	return doc.Operations[0].VariableDefinitions
+}
+
+// skipDirectivesAfterVariables returns the index of the last token at or
+// before j that is not part of a directive of an operation.
+func skipDirectivesAfterVariables(t *symbolTokens, j int) int {
+	for {
+		switch {
+		case t.kindAt(j) == lexer.Name && t.kindAt(j-1) == lexer.At:
+			j -= 2
+		case t.kindAt(j) == lexer.ParenR && t.kindAt(t.opening(j)-1) == lexer.Name && t.kindAt(t.opening(j)-2) == lexer.At:
+			j = t.opening(j) - 1
+		default:
+			return j
+		}
+	}
+}
+
+// isValueStart reports whether the brace at i opens an object value rather
+// than a selection set.
+func isValueStart(t *symbolTokens, i int) bool {
+	switch t.kindAt(i - 1) {
+	case lexer.Colon, lexer.BracketL, lexer.BraceR, lexer.BracketR:
+		return true
+	default:
+		return false
+	}
+}
+
+// suppliedNames returns the names given in the argument list or object value
+// opened at open.
+func suppliedNames(t *symbolTokens, open int) map[string]struct{} {
+	supplied := make(map[string]struct{})
+	depth := 0
+	for i := open + 1; i < len(t.tokens) && depth >= 0; i++ {
+		switch t.tokens[i].Kind {
+		case lexer.ParenL, lexer.BraceL, lexer.BracketL:
+			depth++
+		case lexer.ParenR, lexer.BraceR, lexer.BracketR:
+			depth--
+		case lexer.Name:
+			if depth == 0 && t.kindAt(i+1) == lexer.Colon && t.kindAt(i-1) != lexer.Dollar {
+				supplied[t.tokens[i].Value] = struct{}{}
+			}
+		}
+	}
+	return supplied
+}
+
+// variablesInScope returns the variables of the operation around the rune
+// offset, or those of every operation for a fragment.
+func variablesInScope(doc *ast.QueryDocument, offset int) ast.VariableDefinitionList {
+	if doc == nil {
+		return nil
+	}
+	var scope *ast.OperationDefinition
+	start := -1
+	for _, op := range doc.Operations {
+		if op.Position != nil && op.Position.Start <= offset && op.Position.Start > start {
+			scope, start = op, op.Position.Start
+		}
+	}
+	for _, fragment := range doc.Fragments {
+		if fragment.Position != nil && fragment.Position.Start <= offset && fragment.Position.Start > start {
+			scope, start = nil, fragment.Position.Start
+		}
+	}
+	if scope != nil {
+		return scope.VariableDefinitions
+	}
+	if start < 0 {
+		return nil
+	}
+	var all ast.VariableDefinitionList
+	for _, op := range doc.Operations {
+		all = append(all, op.VariableDefinitions...)
+	}
+	return all
+}
+
+// inputValueNameItems returns the arguments or input fields of values that
+// are not supplied yet, required ones first.
+func inputValueNameItems(values []inputValue, supplied map[string]struct{}, itemKind protocol.CompletionItemKind) []protocol.CompletionItem {
+	items := make([]protocol.CompletionItem, 0, len(values))
+	for _, value := range values {
+		if _, ok := supplied[value.name]; ok {
+			continue
+		}
+		kind := itemKind
+		detail := value.typ.String()
+		if value.defaultValue != nil {
+			detail += " = " + value.defaultValue.String()
+		}
+		insertText := value.name + ": "
+		sortText := "1" + strings.ToLower(value.name)
+		if value.typ.NonNull && value.defaultValue == nil {
+			sortText = "0" + strings.ToLower(value.name)
+		}
+		item := protocol.CompletionItem{
+			Label:      value.name,
+			Kind:       &kind,
+			Detail:     &detail,
+			InsertText: &insertText,
+			SortText:   &sortText,
+		}
+		if value.description != "" {
+			item.Documentation = protocol.MarkupContent{
+				Kind:  protocol.MarkupKindMarkdown,
+				Value: value.description,
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// argumentValueItems returns the values that fit the type of input: enum
+// values, booleans, null, compatible variables, and an input object snippet.
+// With variableOnly, only the variables are returned.
+func argumentValueItems(schema *ast.Schema, input *inputValue, variables ast.VariableDefinitionList, prefix protocol.Range, variableOnly bool) []protocol.CompletionItem {
+	items := make([]protocol.CompletionItem, 0)
+	if variableOnly {
+		return append(items, variableCompletionItems(input, variables, prefix)...)
+	}
+	named := input.typ
+	for named.Elem != nil {
+		named = named.Elem
+	}
+	def := schema.Types[named.NamedType]
+	switch {
+	case def == nil:
+	case def.Kind == ast.Enum:
+		kind := protocol.CompletionItemKindEnumMember
+		for _, value := range def.EnumValues {
+			detail := def.Name
+			item := protocol.CompletionItem{
+				Label:  value.Name,
+				Kind:   &kind,
+				Detail: &detail,
+			}
+			if value.Description != "" {
+				item.Documentation = protocol.MarkupContent{
+					Kind:  protocol.MarkupKindMarkdown,
+					Value: value.Description,
+				}
+			}
+			if value.Directives.ForName("deprecated") != nil {
+				item.Tags = []protocol.CompletionItemTag{protocol.CompletionItemTagDeprecated}
+			}
+			items = append(items, item)
+		}
+	case def.Name == "Boolean":
+		kind := protocol.CompletionItemKindValue
+		for _, value := range []string{"true", "false"} {
+			items = append(items, protocol.CompletionItem{Label: value, Kind: &kind})
+		}
+	case def.Kind == ast.InputObject:
+		kind := protocol.CompletionItemKindStruct
+		detail := def.Name
+		insertText := inputObjectSnippet(def)
+		format := protocol.InsertTextFormatSnippet
+		items = append(items, protocol.CompletionItem{
+			Label:            "{ }",
+			Kind:             &kind,
+			Detail:           &detail,
+			InsertText:       &insertText,
+			InsertTextFormat: &format,
+		})
+	}
+	if !input.typ.NonNull {
+		kind := protocol.CompletionItemKindKeyword
+		items = append(items, protocol.CompletionItem{Label: "null", Kind: &kind})
+	}
+	return append(items, variableCompletionItems(input, variables, prefix)...)
+}
+
+// variableCompletionItems returns the variables that may be used as the
+// value of input, replacing the partial name at prefix.
+func variableCompletionItems(input *inputValue, variables ast.VariableDefinitionList, prefix protocol.Range) []protocol.CompletionItem {
+	items := make([]protocol.CompletionItem, 0, len(variables))
+	for _, v := range variables {
+		if !variableFits(v, input) {
+			continue
+		}
+		kind := protocol.CompletionItemKindVariable
+		label := "$" + v.Variable
+		detail := v.Type.String()
+		items = append(items, protocol.CompletionItem{
+			Label:    label,
+			Kind:     &kind,
+			Detail:   &detail,
+			TextEdit: protocol.TextEdit{Range: prefix, NewText: label},
+		})
+	}
+	return items
+}
+
+// inputObjectSnippet returns an object value snippet with placeholders for
+// the required fields of def.
+func inputObjectSnippet(def *ast.Definition) string {
+	parts := make([]string, 0)
+	for _, field := range def.Fields {
+		if field.Type.NonNull && field.DefaultValue == nil {
+			parts = append(parts, fmt.Sprintf("%s: ${%d}", field.Name, len(parts)+1))
+		}
+	}
+	if len(parts) == 0 {
+		return "{ $0 }"
+	}
+	return "{ " + strings.Join(parts, ", ") + " }"
+}
+
+// variableFits reports whether v may be used as the value of input,
+// allowing a nullable variable for a non-null input when either has a
+// default.
+func variableFits(v *ast.VariableDefinition, input *inputValue) bool {
+	expected := input.typ
+	if expected.NonNull && !v.Type.NonNull {
+		hasDefault := v.DefaultValue != nil && v.DefaultValue.Kind != ast.NullValue || input.defaultValue != nil
+		if !hasDefault {
+			return false
+		}
+		expected = nullableType(expected)
+	}
+	return typeFits(v.Type, expected)
+}
+
+// typeFits reports whether a value of type given may be used where expected
+// is.
+func typeFits(given, expected *ast.Type) bool {
+	if expected.NonNull {
+		if !given.NonNull {
+			return false
+		}
+		return typeFits(nullableType(given), nullableType(expected))
+	}
+	if given.NonNull {
+		return typeFits(nullableType(given), expected)
+	}
+	if expected.Elem != nil {
+		return given.Elem != nil && typeFits(given.Elem, expected.Elem)
+	}
+	return given.Elem == nil && given.NamedType == expected.NamedType
+}
+
+func nullableType(t *ast.Type) *ast.Type {
+	return &ast.Type{NamedType: t.NamedType, Elem: t.Elem}
+}
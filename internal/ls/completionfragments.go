@@ -0,0 +1,104 @@
+package ls
+
+import (
+	"sort"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/lexer"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// fragmentSpreadCompletionItems returns the fragments that may be spread,
+// and an inline fragment snippet, when offset follows `...` in a selection
+// set.
+func (s *Server) fragmentSpreadCompletionItems(uri protocol.DocumentUri, text string, offset int, schema *ast.Schema) ([]protocol.CompletionItem, bool) {
+	source := &ast.Source{Name: string(uri), Input: text}
+	t := newSymbolTokens(source)
+	last, _ := t.beforeCursor(offset)
+	if t.kindAt(last) != lexer.Spread {
+		return nil, false
+	}
+	parent := findCompletionParentTypeFromTokens(t, schema, t.tokens[last].Pos.Start)
+	if parent == nil {
+		return nil, false
+	}
+
+	doc, err := parser.ParseQuery(source)
+	if err != nil {
+		doc = nil
+	}
+	current := enclosingFragmentName(t, last)
+	fragments := s.workspaceFragments(uri, doc)
+	names := make([]string, 0, len(fragments))
+	for name, fragment := range fragments {
+		if name == current || !fragmentApplies(schema, schema.Types[fragment.TypeCondition], parent) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]protocol.CompletionItem, 0, len(names)+1)
+	for _, name := range names {
+		kind := protocol.CompletionItemKindClass
+		detail := "on " + fragments[name].TypeCondition
+		items = append(items, protocol.CompletionItem{
+			Label:  name,
+			Kind:   &kind,
+			Detail: &detail,
+		})
+	}
+	kind := protocol.CompletionItemKindSnippet
+	detail := "inline fragment"
+	insertText := "on ${1:" + parent.Name + "} { $0 }"
+	format := protocol.InsertTextFormatSnippet
+	items = append(items, protocol.CompletionItem{
+		Label:            "on",
+		Kind:             &kind,
+		Detail:           &detail,
+		InsertText:       &insertText,
+		InsertTextFormat: &format,
+	})
+	return items, true
+}
+
+// fragmentApplies reports whether a fragment on typeCondition may be spread
+// in a selection set of parent: whether some object type is both.
+func fragmentApplies(schema *ast.Schema, typeCondition, parent *ast.Definition) bool {
+	if typeCondition == nil || parent == nil {
+		return false
+	}
+	parentTypes := possibleObjectTypes(schema, parent)
+	for name := range possibleObjectTypes(schema, typeCondition) {
+		if _, ok := parentTypes[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// possibleObjectTypes returns the names of the object types def may be.
+func possibleObjectTypes(schema *ast.Schema, def *ast.Definition) map[string]struct{} {
+	names := make(map[string]struct{})
+	if def.Kind == ast.Object {
+		names[def.Name] = struct{}{}
+		return names
+	}
+	for _, possible := range schema.PossibleTypes[def.Name] {
+		if possible != nil && possible.Kind == ast.Object {
+			names[possible.Name] = struct{}{}
+		}
+	}
+	return names
+}
+
+// enclosingFragmentName returns the name of the fragment definition around
+// token i, or "".
+func enclosingFragmentName(t *symbolTokens, i int) string {
+	j := skipDirectivesBefore(t, t.outermostOpen(i)-1)
+	if t.isName(j-1, "on") && t.kindAt(j-2) == lexer.Name && t.isName(j-3, "fragment") {
+		return t.tokens[j-2].Value
+	}
+	return ""
+}
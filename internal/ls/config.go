@@ -0,0 +1,199 @@
+package ls
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileNames lists the graphql-config file names looked up at the
+// workspace root, in priority order. JSON files are parsed as YAML, which is
+// a superset of JSON.
+var configFileNames = []string{
+	".graphqlrc",
+	".graphqlrc.json",
+	".graphqlrc.yaml",
+	".graphqlrc.yml",
+	"graphql.config.json",
+	"graphql.config.yaml",
+	"graphql.config.yml",
+}
+
+type projectConfig struct {
+	Schema    schemaList                `yaml:"schema"`
+	Documents patternList               `yaml:"documents"`
+	Include   patternList               `yaml:"include"`
+	Exclude   patternList               `yaml:"exclude"`
+	Projects  map[string]*projectConfig `yaml:"projects"`
+}
+
+// patternList accepts either a single string or a list of strings.
+type patternList []string
+
+func (p *patternList) UnmarshalYAML(node *yaml.Node) error {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		var value string
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+		*p = patternList{value}
+		return nil
+	case yaml.SequenceNode:
+		var values []string
+		if err := node.Decode(&values); err != nil {
+			return err
+		}
+		*p = values
+		return nil
+	default:
+		return fmt.Errorf("line %d: expected a string or a list of strings", node.Line)
+	}
+}
+
+// schemaList is a patternList whose entries may also map an endpoint URL to
+// its options, as in graphql-config:
+//
+//	schema:
+//	  - https://api.example.com/graphql:
+//	      headers:
+//	        Authorization: Bearer ${API_TOKEN}
+type schemaList struct {
+	patternList
+	endpoints map[string]*endpointConfig
+}
+
+func (l *schemaList) UnmarshalYAML(node *yaml.Node) error {
+	*l = schemaList{}
+	switch node.Kind {
+	case yaml.MappingNode:
+		return l.addEndpoints(node)
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			if item.Kind == yaml.MappingNode {
+				if err := l.addEndpoints(item); err != nil {
+					return err
+				}
+				continue
+			}
+			var value string
+			if err := item.Decode(&value); err != nil {
+				return err
+			}
+			l.patternList = append(l.patternList, value)
+		}
+		return nil
+	default:
+		return l.patternList.UnmarshalYAML(node)
+	}
+}
+
+func (l *schemaList) addEndpoints(node *yaml.Node) error {
+	var endpoints map[string]*endpointConfig
+	if err := node.Decode(&endpoints); err != nil {
+		return err
+	}
+	if l.endpoints == nil {
+		l.endpoints = make(map[string]*endpointConfig)
+	}
+	urls := make([]string, 0, len(endpoints))
+	for url := range endpoints {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		if !isEndpointURL(url) {
+			return fmt.Errorf("line %d: %q is not an http(s) URL", node.Line, url)
+		}
+		l.patternList = append(l.patternList, url)
+		l.endpoints[url] = endpoints[url]
+	}
+	return nil
+}
+
+func findConfigFile(root string) string {
+	if root == "" {
+		return ""
+	}
+	for _, name := range configFileNames {
+		path := filepath.Join(root, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+func readProjectConfig(path string) (*projectConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config projectConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return &config, nil
+}
+
+func (s *Server) loadProjectConfig() {
+	s.state.mu.Lock()
+	root := s.state.rootPath
+	s.state.mu.Unlock()
+
+	path := findConfigFile(root)
+	var config *projectConfig
+	if path != "" {
+		loaded, err := readProjectConfig(path)
+		if err != nil {
+			slog.Warn("failed to load project config", "path", path, "error", err)
+		} else {
+			config = loaded
+		}
+	}
+
+	s.state.index.invalidateScans()
+	s.state.mu.Lock()
+	s.state.config = config
+	s.state.configPath = path
+	previous := s.state.projects
+	s.state.projects = make(map[string]*project)
+	if config != nil {
+		for name, cfg := range config.Projects {
+			if cfg == nil {
+				continue
+			}
+			p := newProject(name)
+			if old := previous[name]; old != nil {
+				// Keep the last good schema until the project reloads.
+				p.schema = old.schema
+				p.schemaURIs = old.schemaURIs
+			}
+			p.config = cfg
+			s.state.projects[name] = &p
+		}
+	}
+	s.state.mu.Unlock()
+	if config != nil {
+		slog.Debug("project config loaded", "path", path, "schema", []string(config.Schema.patternList), "documents", []string(config.Documents), "projects", len(config.Projects))
+	}
+}
+
+func isConfigURI(uri protocol.DocumentUri) bool {
+	path := uriToPath(uri)
+	if path == "" {
+		return false
+	}
+	base := filepath.Base(path)
+	for _, name := range configFileNames {
+		if base == name {
+			return true
+		}
+	}
+	return false
+}
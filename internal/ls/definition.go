@@ -13,9 +13,7 @@ import (
 func (s *Server) definition(_ *glsp.Context, params *protocol.DefinitionParams) (any, error) {
 	uri := params.TextDocument.URI
 
-	s.state.mu.Lock()
-	schema := s.state.schema
-	s.state.mu.Unlock()
+	schema := s.schemaForURI(uri)
 	if schema == nil {
 		slog.Debug("definition: schema not loaded", "uri", uri)
 		return nil, nil
@@ -53,6 +51,22 @@ func (s *Server) definition(_ *glsp.Context, params *protocol.DefinitionParams)
 		return nil, nil
 	}
 
+	if spread := findFragmentSpreadAtPosition(doc, offset, line, column); spread != nil {
+		fragments := s.workspaceFragments(uri, doc)
+		loc := fragmentDefinitionLocation(fragments[spread.Name])
+		if loc == nil {
+			slog.Debug("definition: fragment not found", "uri", uri, "fragment", spread.Name)
+			return nil, nil
+		}
+		slog.Debug("definition: fragment resolved", "uri", uri, "fragment", spread.Name, "target", loc.URI)
+		return []protocol.Location{*loc}, nil
+	}
+
+	if locs := findQueryReferenceLocations(doc, schema, offset); len(locs) > 0 {
+		slog.Debug("definition: reference resolved", "uri", uri, "line", line, "column", column)
+		return locs, nil
+	}
+
 	def := findFieldDefinitionAtPosition(doc, schema, offset, line, column)
 	if def == nil {
 		slog.Debug("definition: field not found", "uri", uri, "line", line, "column", column)
@@ -136,17 +150,21 @@ func findFieldDefinitionAtPosition(doc *ast.QueryDocument, schema *ast.Schema, o
 		return nil
 	}
 
-	fragments := make(map[string]*ast.FragmentDefinition, len(doc.Fragments))
-	for _, fragment := range doc.Fragments {
-		fragments[fragment.Name] = fragment
-	}
-
 	for _, op := range doc.Operations {
 		root := rootTypeForOperation(schema, op.Operation)
 		if root == nil {
 			continue
 		}
-		if def := findFieldDefinitionInSelectionSet(op.SelectionSet, schema, root, fragments, offset, line, column); def != nil {
+		if def := findFieldDefinitionInSelectionSet(op.SelectionSet, schema, root, offset, line, column); def != nil {
+			return def
+		}
+	}
+	for _, fragment := range doc.Fragments {
+		root := schema.Types[fragment.TypeCondition]
+		if root == nil {
+			continue
+		}
+		if def := findFieldDefinitionInSelectionSet(fragment.SelectionSet, schema, root, offset, line, column); def != nil {
 			return def
 		}
 	}
@@ -154,7 +172,7 @@ func findFieldDefinitionAtPosition(doc *ast.QueryDocument, schema *ast.Schema, o
 	return nil
 }
 
-func findFieldDefinitionInSelectionSet(set ast.SelectionSet, schema *ast.Schema, parent *ast.Definition, fragments map[string]*ast.FragmentDefinition, offset, line, column int) *ast.FieldDefinition {
+func findFieldDefinitionInSelectionSet(set ast.SelectionSet, schema *ast.Schema, parent *ast.Definition, offset, line, column int) *ast.FieldDefinition {
 	if parent == nil {
 		return nil
 	}
@@ -171,7 +189,7 @@ func findFieldDefinitionInSelectionSet(set ast.SelectionSet, schema *ast.Schema,
 				continue
 			}
 			nextParent := schema.Types[def.Type.Name()]
-			if found := findFieldDefinitionInSelectionSet(sel.SelectionSet, schema, nextParent, fragments, offset, line, column); found != nil {
+			if found := findFieldDefinitionInSelectionSet(sel.SelectionSet, schema, nextParent, offset, line, column); found != nil {
 				return found
 			}
 		case *ast.InlineFragment:
@@ -181,27 +199,71 @@ func findFieldDefinitionInSelectionSet(set ast.SelectionSet, schema *ast.Schema,
 					nextParent = def
 				}
 			}
-			if found := findFieldDefinitionInSelectionSet(sel.SelectionSet, schema, nextParent, fragments, offset, line, column); found != nil {
+			if found := findFieldDefinitionInSelectionSet(sel.SelectionSet, schema, nextParent, offset, line, column); found != nil {
 				return found
 			}
-		case *ast.FragmentSpread:
-			fragment := fragments[sel.Name]
-			if fragment == nil {
+		}
+	}
+
+	return nil
+}
+
+// findQueryReferenceLocations resolves the name at offset in an operation
+// document to where it is declared: the schema element it refers to, or the
+// declaration of a variable.
+func findQueryReferenceLocations(doc *ast.QueryDocument, schema *ast.Schema, offset int) []protocol.Location {
+	for _, name := range queryNames(doc, schema) {
+		if name.covers(offset) {
+			return queryNameDefinitionLocations(name)
+		}
+	}
+	return nil
+}
+
+func queryNameDefinitionLocations(name queryName) []protocol.Location {
+	var declName string
+	var pos *ast.Position
+	switch name.kind {
+	case queryNameField, queryNameInputField:
+		if name.field != nil {
+			declName, pos = name.field.Name, name.field.Position
+		}
+	case queryNameArgument:
+		if name.argument != nil {
+			declName, pos = name.argument.Name, name.argument.Position
+		}
+	case queryNameEnumValue:
+		if name.enumValue != nil {
+			declName, pos = name.enumValue.Name, name.enumValue.Position
+		}
+	case queryNameDirective:
+		if name.directive != nil {
+			declName, pos = name.directive.Name, name.directive.Position
+		}
+	case queryNameType:
+		if name.typeDef != nil {
+			declName, pos = name.typeDef.Name, name.typeDef.Position
+		}
+	case queryNameVariable:
+		var locs []protocol.Location
+		for _, v := range name.variables {
+			if "$"+v.Variable != name.text {
 				continue
 			}
-			nextParent := parent
-			if fragment.TypeCondition != "" {
-				if def := schema.Types[fragment.TypeCondition]; def != nil {
-					nextParent = def
-				}
-			}
-			if found := findFieldDefinitionInSelectionSet(fragment.SelectionSet, schema, nextParent, fragments, offset, line, column); found != nil {
-				return found
+			if loc := locationFromDefinition(name.text, v.Position); loc != nil {
+				locs = append(locs, *loc)
 			}
 		}
+		return locs
 	}
-
-	return nil
+	if pos == nil || isBuiltInPosition(pos) {
+		return nil
+	}
+	loc := locationFromDefinition(declName, pos)
+	if loc == nil {
+		return nil
+	}
+	return []protocol.Location{*loc}
 }
 
 func findTypeDefinitionLocation(schema *ast.Schema, uri protocol.DocumentUri, text string, line, column int) *protocol.Location {
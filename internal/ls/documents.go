@@ -2,8 +2,10 @@ package ls
 
 import (
 	"os"
+	"sort"
 
 	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/vektah/gqlparser/v2/ast"
 )
 
 func readDocument(state *State, uri protocol.DocumentUri, path string) (string, bool) {
@@ -13,10 +15,84 @@ func readDocument(state *State, uri protocol.DocumentUri, path string) (string,
 		return text, true
 	}
 	state.mu.Unlock()
+	return state.index.readFile(uri, path)
+}
+
+// collectDocumentSources returns the executable documents (operations and
+// fragments) that belong to p, preferring open editor buffers over disk.
+func (s *Server) collectDocumentSources(p *project) []*ast.Source {
+	s.state.mu.Lock()
+	root := s.state.rootPath
+	openDocs := make(map[protocol.DocumentUri]string, len(s.state.docs))
+	for uri, text := range s.state.docs {
+		openDocs[uri] = text
+	}
+	s.state.mu.Unlock()
 
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return "", false
+	byURI := make(map[protocol.DocumentUri]*ast.Source)
+	addFile := func(path string) {
+		uri := pathToURI(path)
+		if _, ok := byURI[uri]; ok || !s.ownsDocument(p, uri) {
+			return
+		}
+		content, ok := readDocument(s.state, uri, path)
+		if !ok || !isExecutableDocument(content) {
+			return
+		}
+		byURI[uri] = &ast.Source{
+			Name:  string(uri),
+			Input: content,
+		}
+	}
+	if patterns := s.documentPatterns(p); len(patterns) > 0 {
+		stats := newScanStats()
+		for _, pattern := range patterns {
+			for _, path := range expandPattern(s.state, root, pattern) {
+				info, err := os.Stat(path)
+				if err != nil {
+					continue
+				}
+				if info.IsDir() {
+					walkGraphQLFiles(s.state, path, stats, addFile)
+					continue
+				}
+				if isGraphQLFile(path) {
+					addFile(path)
+				}
+			}
+		}
+	} else if root != "" {
+		walkGraphQLFiles(s.state, root, newScanStats(), addFile)
+	}
+	for uri, text := range openDocs {
+		if _, ok := byURI[uri]; ok || !isExecutableDocument(text) || !s.ownsDocument(p, uri) {
+			continue
+		}
+		byURI[uri] = &ast.Source{
+			Name:  string(uri),
+			Input: text,
+		}
+	}
+
+	sources := make([]*ast.Source, 0, len(byURI))
+	for _, source := range byURI {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Name < sources[j].Name
+	})
+	return sources
+}
+
+func (s *Server) ownsDocument(p *project, uri protocol.DocumentUri) bool {
+	if s.projectForURI(uri) != p {
+		return false
+	}
+	path := uriToPath(uri)
+	if path == "" {
+		return true
 	}
-	return string(data), true
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	return p.includesPath(s.state.rootPath, path)
 }
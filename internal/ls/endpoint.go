@@ -0,0 +1,363 @@
+package ls
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const (
+	// refreshSchemaCommand re-fetches every endpoint schema.
+	refreshSchemaCommand = "graphql.refreshSchema"
+
+	endpointTimeout      = 10 * time.Second
+	maxIntrospectionSize = 64 << 20
+
+	// endpointRetryDelay is how long a failed endpoint is left alone before
+	// it is fetched again, unless its refresh interval is shorter.
+	endpointRetryDelay = 5 * time.Minute
+)
+
+// endpointConfig holds the options of a schema endpoint. Header values may
+// reference environment variables as `$NAME` or `${NAME}`.
+type endpointConfig struct {
+	Headers map[string]string `yaml:"headers"`
+	// RefreshInterval re-fetches the schema each time it elapses after a
+	// fetch. Zero fetches once per session.
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+}
+
+// introspectionQuery is the query graphql-js builds with its default options.
+const introspectionQuery = `query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types { ...FullType }
+    directives {
+      name
+      description
+      locations
+      args { ...InputValue }
+    }
+  }
+}
+
+fragment FullType on __Type {
+  kind
+  name
+  description
+  fields(includeDeprecated: true) {
+    name
+    description
+    args { ...InputValue }
+    type { ...TypeRef }
+    isDeprecated
+    deprecationReason
+  }
+  inputFields { ...InputValue }
+  interfaces { ...TypeRef }
+  enumValues(includeDeprecated: true) {
+    name
+    description
+    isDeprecated
+    deprecationReason
+  }
+  possibleTypes { ...TypeRef }
+}
+
+fragment InputValue on __InputValue {
+  name
+  description
+  type { ...TypeRef }
+  defaultValue
+}
+
+fragment TypeRef on __Type {
+  kind
+  name
+  ofType {
+    kind
+    name
+    ofType {
+      kind
+      name
+      ofType {
+        kind
+        name
+        ofType {
+          kind
+          name
+          ofType {
+            kind
+            name
+            ofType {
+              kind
+              name
+              ofType {
+                kind
+                name
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}
+`
+
+func isEndpointURL(pattern string) bool {
+	return strings.HasPrefix(pattern, "http://") || strings.HasPrefix(pattern, "https://")
+}
+
+// endpointCachePath returns where the introspection result of url is kept
+// between sessions: under dir, or the user cache directory when dir is "".
+func endpointCachePath(dir, url string) (string, error) {
+	if dir == "" {
+		userDir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(userDir, ServerName)
+	}
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(dir, "introspection", hex.EncodeToString(sum[:8])+".json"), nil
+}
+
+// resolveEndpoints replaces the endpoint URLs among patterns with their
+// introspection cache files, starting fetches for the schemas that are due.
+func (s *Server) resolveEndpoints(p *project, patterns []string) []string {
+	resolved := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if !isEndpointURL(pattern) {
+			resolved = append(resolved, pattern)
+			continue
+		}
+		if path := s.endpointSchemaPath(pattern, s.endpointOptions(p, pattern)); path != "" {
+			resolved = append(resolved, path)
+		}
+	}
+	return resolved
+}
+
+// endpointSchemaPath returns the cache file of url, or "" when there is none
+// yet. When url has neither been fetched this session nor failed since its
+// retry timer was armed, it starts a fetch in the background, which reloads
+// the schemas once it succeeds.
+func (s *Server) endpointSchemaPath(url string, options *endpointConfig) string {
+	s.state.mu.Lock()
+	dir := s.state.cacheDir
+	s.state.mu.Unlock()
+	path, err := endpointCachePath(dir, url)
+	if err != nil {
+		slog.Warn("schema endpoint cache unavailable", "url", url, "error", err)
+		return ""
+	}
+
+	s.state.mu.Lock()
+	_, fetched := s.state.endpointFetches[url]
+	_, fetching := s.state.endpointsFetching[url]
+	_, failed := s.state.endpointFailures[url]
+	due := !fetched && !fetching && !failed
+	if due {
+		s.state.endpointsFetching[url] = struct{}{}
+	}
+	s.state.mu.Unlock()
+	if due {
+		s.fetches.Add(1)
+		go s.fetchEndpoint(url, path, options)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// fetchEndpoint refreshes the cache file of url and reloads the schemas when
+// it changed. With a refresh interval it then schedules the next fetch. A
+// failed fetch keeps the previous cache, and reloads skip url until a retry
+// timer fires.
+func (s *Server) fetchEndpoint(url, path string, options *endpointConfig) {
+	defer s.fetches.Done()
+	var headers map[string]string
+	var interval time.Duration
+	if options != nil {
+		headers = options.Headers
+		interval = options.RefreshInterval
+	}
+
+	data, err := fetchIntrospection(url, headers)
+	if err == nil {
+		err = writeEndpointCache(path, data)
+	}
+
+	s.state.mu.Lock()
+	delete(s.state.endpointsFetching, url)
+	delay := interval
+	if err == nil {
+		s.state.endpointFetches[url] = time.Now()
+		delete(s.state.endpointFailures, url)
+	} else {
+		s.state.endpointFailures[url] = time.Now()
+		if delay == 0 || delay > endpointRetryDelay {
+			delay = endpointRetryDelay
+		}
+	}
+	if delay > 0 && s.state.endpointTimers != nil {
+		if timer := s.state.endpointTimers[url]; timer != nil {
+			timer.Stop()
+		}
+		s.state.endpointTimers[url] = time.AfterFunc(delay, func() {
+			s.refreshEndpoint(url)
+		})
+	}
+	ctx := s.state.clientCtx
+	s.state.mu.Unlock()
+
+	if err != nil {
+		slog.Warn("schema introspection failed", "url", url, "error", err)
+		return
+	}
+	slog.Debug("schema introspection fetched", "url", url, "path", path)
+	// The rewrite may keep the size and modification time of the old copy.
+	s.state.index.forget(pathToURI(path))
+	if ctx != nil {
+		s.loadWorkspaceSchema(ctx)
+	}
+}
+
+// refreshEndpoint marks url as due and reloads the schemas, which fetches it
+// again.
+func (s *Server) refreshEndpoint(url string) {
+	s.state.mu.Lock()
+	stopped := s.state.endpointTimers == nil
+	if !stopped {
+		delete(s.state.endpointFetches, url)
+		delete(s.state.endpointFailures, url)
+	}
+	ctx := s.state.clientCtx
+	s.state.mu.Unlock()
+	if !stopped && ctx != nil {
+		s.loadWorkspaceSchema(ctx)
+	}
+}
+
+// stopEndpointTimers cancels the scheduled refreshes and keeps new ones from
+// being scheduled.
+func (s *Server) stopEndpointTimers() {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	for _, timer := range s.state.endpointTimers {
+		timer.Stop()
+	}
+	s.state.endpointTimers = nil
+}
+
+// fetchIntrospection runs the introspection query against url and returns
+// the indented response.
+func fetchIntrospection(url string, headers map[string]string) ([]byte, error) {
+	body, err := json.Marshal(map[string]string{
+		"query":         introspectionQuery,
+		"operationName": "IntrospectionQuery",
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), endpointTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxIntrospectionSize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var result struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	if _, err := parseIntrospection("", string(data)); err != nil {
+		if len(result.Errors) > 0 {
+			return nil, errors.New(result.Errors[0].Message)
+		}
+		return nil, err
+	}
+	// Indent so positions in the cache file land on separate lines.
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+func writeEndpointCache(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".introspection-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *Server) executeCommand(ctx *glsp.Context, params *protocol.ExecuteCommandParams) (any, error) {
+	slog.Debug("executeCommand", "command", params.Command)
+	switch params.Command {
+	case refreshSchemaCommand:
+		s.state.mu.Lock()
+		clear(s.state.endpointFetches)
+		clear(s.state.endpointFailures)
+		s.state.mu.Unlock()
+		s.loadWorkspaceSchema(ctx)
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown command %q", params.Command)
+	}
+}
@@ -0,0 +1,870 @@
+package ls
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/lexer"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// defaultPrintWidth is the line width past which argument lists wrap.
+const defaultPrintWidth = 80
+
+type formatOptions struct {
+	indent  string
+	tabSize int
+	width   int
+}
+
+func defaultFormatOptions() formatOptions {
+	return formatOptions{
+		indent:  "  ",
+		tabSize: 2,
+		width:   defaultPrintWidth,
+	}
+}
+
+// formatDocument pretty-prints a schema or executable document. Its structure
+// comes from the AST while every token, comments included, is copied from the
+// source, so the result lexes to exactly the tokens of text or an error is
+// returned. Documents with CRLF line endings keep them.
+func formatDocument(text string, schema bool, options formatOptions) (string, error) {
+	source := &ast.Source{Input: text}
+	p, err := newPrinter(source, options)
+	if err != nil {
+		return "", err
+	}
+	if schema {
+		doc, err := parser.ParseSchema(source)
+		if err != nil {
+			return "", err
+		}
+		p.schemaDocument(doc)
+	} else {
+		doc, err := parser.ParseQuery(source)
+		if err != nil {
+			return "", err
+		}
+		p.queryDocument(doc)
+	}
+	if p.err != nil {
+		return "", p.err
+	}
+	formatted := string(p.out)
+	if err := sameTokens(text, formatted); err != nil {
+		return "", err
+	}
+	if strings.Contains(text, "\r\n") {
+		formatted = strings.ReplaceAll(formatted, "\n", "\r\n")
+	}
+	return formatted, nil
+}
+
+// printer writes a document while walking its source tokens in step. Each
+// printed token must be the next significant source token; comments met on
+// the way are printed where they stood: on the line of the previous token or
+// on lines of their own.
+type printer struct {
+	options formatOptions
+	runes   []rune
+	// lineStarts are the rune offsets at which source lines start.
+	lineStarts []int
+	tokens     []lexer.Token
+	next       int
+	// prevLine is the source line the last consumed token ended on.
+	prevLine int
+	err      error
+
+	out          []byte
+	column       int
+	lineStart    bool
+	pendingSpace bool
+	depth        int
+
+	// flat is set while trying a group on one line; flatFailed records that
+	// it needed a line break.
+	flat       bool
+	flatFailed bool
+}
+
+func newPrinter(source *ast.Source, options formatOptions) (*printer, error) {
+	tokens, err := lexTokens(source.Input)
+	if err != nil {
+		return nil, err
+	}
+	p := &printer{
+		options:    options,
+		runes:      []rune(source.Input),
+		lineStarts: []int{0},
+		tokens:     tokens,
+		lineStart:  true,
+	}
+	for i, r := range p.runes {
+		if r == '\n' {
+			p.lineStarts = append(p.lineStarts, i+1)
+		}
+	}
+	return p, nil
+}
+
+func lexTokens(text string) ([]lexer.Token, error) {
+	lex := lexer.New(&ast.Source{Input: text})
+	var tokens []lexer.Token
+	for {
+		tok, err := lex.ReadToken()
+		if err != nil {
+			return nil, err
+		}
+		if tok.Kind == lexer.EOF {
+			return tokens, nil
+		}
+		tokens = append(tokens, tok)
+	}
+}
+
+// sameTokens reports an error unless a and b lex to the same tokens, apart
+// from the optional leading `&` of interface lists and `|` of union members
+// and directive locations, which the printer drops.
+func sameTokens(a, b string) error {
+	ta, err := lexTokens(a)
+	if err != nil {
+		return err
+	}
+	tb, err := lexTokens(b)
+	if err != nil {
+		return fmt.Errorf("formatted document does not lex: %w", err)
+	}
+	ta, tb = withoutLeadingSeparators(ta), withoutLeadingSeparators(tb)
+	if len(ta) != len(tb) {
+		return fmt.Errorf("formatting changed the number of tokens from %d to %d", len(ta), len(tb))
+	}
+	for i := range ta {
+		if ta[i].Kind != tb[i].Kind || strings.TrimRight(ta[i].Value, " \t\r") != strings.TrimRight(tb[i].Value, " \t\r") {
+			return fmt.Errorf("formatting changed token %q at line %d", ta[i].Value, ta[i].Pos.Line)
+		}
+	}
+	return nil
+}
+
+func withoutLeadingSeparators(tokens []lexer.Token) []lexer.Token {
+	kept := tokens[:0:0]
+	prev := lexer.Token{}
+	for _, tok := range tokens {
+		leading := tok.Kind == lexer.Amp && prev.Kind == lexer.Name && prev.Value == "implements" ||
+			tok.Kind == lexer.Pipe && (prev.Kind == lexer.Equals || prev.Kind == lexer.Name && prev.Value == "on")
+		if tok.Kind != lexer.Comment {
+			prev = tok
+		}
+		if !leading {
+			kept = append(kept, tok)
+		}
+	}
+	return kept
+}
+
+// Output.
+
+func (p *printer) write(s string) {
+	if p.lineStart {
+		p.out = append(p.out, strings.Repeat(p.options.indent, p.depth)...)
+		p.column = p.depth * p.indentWidth()
+		p.lineStart = false
+	} else if p.pendingSpace {
+		p.out = append(p.out, ' ')
+		p.column++
+	}
+	p.pendingSpace = false
+	p.out = append(p.out, s...)
+	p.column += utf8.RuneCountInString(s)
+}
+
+func (p *printer) indentWidth() int {
+	if p.options.indent == "\t" {
+		return p.options.tabSize
+	}
+	return len(p.options.indent)
+}
+
+// space separates the next token from the previous one on the same line.
+func (p *printer) space() {
+	if !p.lineStart {
+		p.pendingSpace = true
+	}
+}
+
+func (p *printer) newline() {
+	if p.flat {
+		p.flatFailed = true
+		return
+	}
+	p.out = append(p.out, '\n')
+	p.column = 0
+	p.lineStart = true
+	p.pendingSpace = false
+}
+
+// line moves to the start of a line unless already there.
+func (p *printer) line() {
+	if !p.lineStart {
+		p.newline()
+	}
+}
+
+// blankLine leaves an empty line before the next token, except at the start
+// of the document and right after an opening bracket.
+func (p *printer) blankLine() {
+	p.line()
+	n := len(p.out)
+	if p.flat || n < 2 || p.out[n-2] == '\n' {
+		return
+	}
+	switch p.out[n-2] {
+	case '{', '(', '[':
+		return
+	}
+	p.newline()
+}
+
+// unbreak joins the current empty line with the previous one, so a comment
+// that trailed a token in the source can trail it again.
+func (p *printer) unbreak() bool {
+	n := len(p.out)
+	if !p.lineStart || n < 2 || p.out[n-1] != '\n' || p.out[n-2] == '\n' {
+		return false
+	}
+	p.out = p.out[:n-1]
+	start := bytes.LastIndexByte(p.out, '\n') + 1
+	p.column = utf8.RuneCount(p.out[start:])
+	p.lineStart = false
+	return true
+}
+
+type printerState struct {
+	out          int
+	column       int
+	lineStart    bool
+	pendingSpace bool
+	depth        int
+	next         int
+	prevLine     int
+}
+
+func (p *printer) save() printerState {
+	return printerState{
+		out:          len(p.out),
+		column:       p.column,
+		lineStart:    p.lineStart,
+		pendingSpace: p.pendingSpace,
+		depth:        p.depth,
+		next:         p.next,
+		prevLine:     p.prevLine,
+	}
+}
+
+func (p *printer) restore(state printerState) {
+	p.out = p.out[:state.out]
+	p.column = state.column
+	p.lineStart = state.lineStart
+	p.pendingSpace = state.pendingSpace
+	p.depth = state.depth
+	p.next = state.next
+	p.prevLine = state.prevLine
+	p.flatFailed = false
+}
+
+// group prints flat when that fits on the line without breaks, and broken
+// otherwise.
+func (p *printer) group(flat, broken func()) {
+	if p.flat {
+		flat()
+		return
+	}
+	state := p.save()
+	p.flat = true
+	flat()
+	p.flat = false
+	if !p.flatFailed && p.column <= p.options.width {
+		return
+	}
+	p.restore(state)
+	broken()
+}
+
+// Source tokens.
+
+func (p *printer) raw(tok lexer.Token) string {
+	return string(p.runes[tok.Pos.Start:tok.Pos.End])
+}
+
+// sourceLine returns the 1-based source line of a rune offset.
+func (p *printer) sourceLine(offset int) int {
+	return sort.Search(len(p.lineStarts), func(i int) bool {
+		return p.lineStarts[i] > offset
+	})
+}
+
+// gapBeforeNext reports whether a blank line separates the last consumed
+// token from the next one in the source.
+func (p *printer) gapBeforeNext() bool {
+	return p.prevLine > 0 && p.next < len(p.tokens) && p.sourceLine(p.tokens[p.next].Pos.Start) > p.prevLine+1
+}
+
+// peek returns the i-th significant token after the cursor.
+func (p *printer) peek(i int) lexer.Token {
+	for j := p.next; j < len(p.tokens); j++ {
+		if p.tokens[j].Kind == lexer.Comment {
+			continue
+		}
+		if i == 0 {
+			return p.tokens[j]
+		}
+		i--
+	}
+	return lexer.Token{Kind: lexer.EOF}
+}
+
+func (p *printer) peekKind(i int) lexer.Type {
+	return p.peek(i).Kind
+}
+
+func (p *printer) peekKeyword(value string) bool {
+	tok := p.peek(0)
+	return tok.Kind == lexer.Name && tok.Value == value
+}
+
+// take prints the comments before the next source token and consumes it.
+func (p *printer) take(kind lexer.Type) (lexer.Token, bool) {
+	p.flushComments()
+	if p.err != nil {
+		return lexer.Token{}, false
+	}
+	if p.next >= len(p.tokens) || p.tokens[p.next].Kind != kind {
+		found := "end of document"
+		if p.next < len(p.tokens) {
+			found = p.tokens[p.next].Kind.Name()
+		}
+		p.err = fmt.Errorf("formatter expected %s, found %s", kind.Name(), found)
+		return lexer.Token{}, false
+	}
+	tok := p.tokens[p.next]
+	p.next++
+	p.prevLine = p.sourceLine(tok.Pos.End)
+	return tok, true
+}
+
+// token prints the next source token, which must be of kind.
+func (p *printer) token(kind lexer.Type) {
+	tok, ok := p.take(kind)
+	if !ok {
+		return
+	}
+	if kind == lexer.BlockString {
+		p.blockString(tok)
+		return
+	}
+	p.write(p.raw(tok))
+}
+
+func (p *printer) keyword(value string) {
+	if tok := p.peek(0); tok.Kind != lexer.Name || tok.Value != value {
+		if p.err == nil {
+			p.err = fmt.Errorf("formatter expected %q, found %q", value, tok.Value)
+		}
+		return
+	}
+	p.token(lexer.Name)
+}
+
+// skip consumes an optional source token of kind without printing it.
+func (p *printer) skip(kind lexer.Type) {
+	if p.peekKind(0) == kind {
+		p.take(kind)
+	}
+}
+
+func (p *printer) flushComments() {
+	flushed := false
+	for p.next < len(p.tokens) && p.tokens[p.next].Kind == lexer.Comment {
+		tok := p.tokens[p.next]
+		line := p.sourceLine(tok.Pos.Start)
+		if !flushed && p.prevLine > 0 && line == p.prevLine && (!p.lineStart || p.unbreak()) {
+			p.space()
+		} else {
+			p.line()
+			if p.gapBeforeNext() {
+				p.blankLine()
+			}
+		}
+		p.next++
+		p.write(strings.TrimRight(p.raw(tok), " \t\r"))
+		p.newline()
+		p.prevLine = line
+		flushed = true
+	}
+	if flushed && p.gapBeforeNext() {
+		p.blankLine()
+	}
+}
+
+// itemBreak starts the next item of a block on a new line, keeping one blank
+// line where the source separated the items with any.
+func (p *printer) itemBreak() {
+	p.line()
+	if p.gapBeforeNext() {
+		p.blankLine()
+	}
+}
+
+// blockString reindents a block string written over several lines to the
+// current depth. Block strings written on one line, and values that would
+// not survive reindenting, are copied as written.
+func (p *printer) blockString(tok lexer.Token) {
+	raw := p.raw(tok)
+	if !strings.Contains(raw, "\n") {
+		p.write(raw)
+		return
+	}
+	if p.flat {
+		p.flatFailed = true
+		return
+	}
+	value := strings.ReplaceAll(tok.Value, `"""`, `\"""`)
+	if strings.HasPrefix(value, " ") || strings.HasPrefix(value, "\t") {
+		p.write(raw)
+		return
+	}
+	p.write(`"""`)
+	for line := range strings.SplitSeq(value, "\n") {
+		p.newline()
+		if line != "" {
+			p.write(line)
+		}
+	}
+	p.newline()
+	p.write(`"""`)
+}
+
+// description prints the description of the next definition, if any, on a
+// line of its own.
+func (p *printer) description() {
+	switch p.peekKind(0) {
+	case lexer.String, lexer.BlockString:
+		p.token(p.peekKind(0))
+		p.line()
+	}
+}
+
+// block prints n items one per line between braces.
+func (p *printer) block(n int, item func(i int)) {
+	p.token(lexer.BraceL)
+	p.depth++
+	for i := range n {
+		if i == 0 {
+			p.line()
+		} else {
+			p.itemBreak()
+		}
+		item(i)
+	}
+	p.flushComments()
+	p.depth--
+	p.line()
+	p.token(lexer.BraceR)
+}
+
+// list prints n items between brackets on one line when they fit within the
+// print width, and one per line otherwise. Padded lists keep a space inside
+// their brackets when flat.
+func (p *printer) list(open, closing lexer.Type, n int, padded bool, item func(i int)) {
+	flat := func() {
+		p.token(open)
+		for i := range n {
+			if i > 0 {
+				p.write(",")
+				p.space()
+			} else if padded {
+				p.space()
+			}
+			item(i)
+		}
+		if padded && n > 0 {
+			p.space()
+		}
+		p.token(closing)
+	}
+	if n == 0 {
+		flat()
+		return
+	}
+	p.group(flat, func() {
+		p.token(open)
+		p.depth++
+		for i := range n {
+			if i == 0 {
+				p.line()
+			} else {
+				p.itemBreak()
+			}
+			item(i)
+		}
+		p.flushComments()
+		p.depth--
+		p.line()
+		p.token(closing)
+	})
+}
+
+// end prints the comments after the last definition.
+func (p *printer) end() {
+	p.flushComments()
+	p.line()
+	if p.err == nil && p.next < len(p.tokens) {
+		p.err = fmt.Errorf("formatter stopped at line %d", p.tokens[p.next].Pos.Line)
+	}
+}
+
+// Schema documents.
+
+type printNode struct {
+	start int
+	print func()
+}
+
+func (p *printer) nodes(nodes []printNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].start < nodes[j].start
+	})
+	for _, node := range nodes {
+		p.blankLine()
+		node.print()
+	}
+	p.end()
+}
+
+func (p *printer) schemaDocument(doc *ast.SchemaDocument) {
+	var nodes []printNode
+	for _, def := range doc.Schema {
+		nodes = append(nodes, printNode{def.Position.Start, func() { p.schemaDefinition(def, false) }})
+	}
+	for _, def := range doc.SchemaExtension {
+		nodes = append(nodes, printNode{def.Position.Start, func() { p.schemaDefinition(def, true) }})
+	}
+	for _, def := range doc.Directives {
+		nodes = append(nodes, printNode{def.Position.Start, func() { p.directiveDefinition(def) }})
+	}
+	for _, def := range doc.Definitions {
+		nodes = append(nodes, printNode{def.Position.Start, func() { p.definition(def, false) }})
+	}
+	for _, def := range doc.Extensions {
+		nodes = append(nodes, printNode{def.Position.Start, func() { p.definition(def, true) }})
+	}
+	p.nodes(nodes)
+}
+
+func (p *printer) schemaDefinition(def *ast.SchemaDefinition, extend bool) {
+	if extend {
+		p.keyword("extend")
+		p.space()
+	} else {
+		p.description()
+	}
+	p.keyword("schema")
+	p.directives(def.Directives)
+	if p.peekKind(0) == lexer.BraceL {
+		p.space()
+		p.block(len(def.OperationTypes), func(int) {
+			p.token(lexer.Name)
+			p.token(lexer.Colon)
+			p.space()
+			p.token(lexer.Name)
+		})
+	}
+}
+
+func (p *printer) definition(def *ast.Definition, extend bool) {
+	if extend {
+		p.keyword("extend")
+		p.space()
+	} else {
+		p.description()
+	}
+	p.token(lexer.Name)
+	p.space()
+	p.token(lexer.Name)
+
+	if len(def.Interfaces) > 0 {
+		p.space()
+		p.keyword("implements")
+		p.space()
+		p.skip(lexer.Amp)
+		for i := range def.Interfaces {
+			if i > 0 {
+				p.space()
+				p.token(lexer.Amp)
+				p.space()
+			}
+			p.token(lexer.Name)
+		}
+	}
+	p.directives(def.Directives)
+
+	switch {
+	case def.Kind == ast.Union && p.peekKind(0) == lexer.Equals:
+		p.space()
+		p.token(lexer.Equals)
+		p.space()
+		p.skip(lexer.Pipe)
+		for i := range def.Types {
+			if i > 0 {
+				p.space()
+				p.token(lexer.Pipe)
+				p.space()
+			}
+			p.token(lexer.Name)
+		}
+	case def.Kind == ast.Enum && p.peekKind(0) == lexer.BraceL:
+		p.space()
+		p.block(len(def.EnumValues), func(i int) {
+			p.description()
+			p.token(lexer.Name)
+			p.directives(def.EnumValues[i].Directives)
+		})
+	case p.peekKind(0) == lexer.BraceL:
+		p.space()
+		p.block(len(def.Fields), func(i int) {
+			p.fieldDefinition(def.Fields[i])
+		})
+	}
+}
+
+func (p *printer) fieldDefinition(field *ast.FieldDefinition) {
+	p.description()
+	p.token(lexer.Name)
+	if p.peekKind(0) == lexer.ParenL {
+		p.argumentDefinitions(field.Arguments)
+	}
+	p.token(lexer.Colon)
+	p.space()
+	p.typeRef(field.Type)
+	p.defaultValue(field.DefaultValue)
+	p.directives(field.Directives)
+}
+
+func (p *printer) argumentDefinitions(args ast.ArgumentDefinitionList) {
+	p.list(lexer.ParenL, lexer.ParenR, len(args), false, func(i int) {
+		arg := args[i]
+		p.description()
+		p.token(lexer.Name)
+		p.token(lexer.Colon)
+		p.space()
+		p.typeRef(arg.Type)
+		p.defaultValue(arg.DefaultValue)
+		p.directives(arg.Directives)
+	})
+}
+
+func (p *printer) directiveDefinition(def *ast.DirectiveDefinition) {
+	p.description()
+	p.keyword("directive")
+	p.space()
+	p.token(lexer.At)
+	p.token(lexer.Name)
+	if p.peekKind(0) == lexer.ParenL {
+		p.argumentDefinitions(def.Arguments)
+	}
+	if p.peekKeyword("repeatable") {
+		p.space()
+		p.token(lexer.Name)
+	}
+	p.space()
+	p.keyword("on")
+	p.space()
+	p.skip(lexer.Pipe)
+	for i := range def.Locations {
+		if i > 0 {
+			p.space()
+			p.token(lexer.Pipe)
+			p.space()
+		}
+		p.token(lexer.Name)
+	}
+}
+
+func (p *printer) typeRef(t *ast.Type) {
+	if t.Elem != nil {
+		p.token(lexer.BracketL)
+		p.typeRef(t.Elem)
+		p.token(lexer.BracketR)
+	} else {
+		p.token(lexer.Name)
+	}
+	if t.NonNull {
+		p.token(lexer.Bang)
+	}
+}
+
+func (p *printer) defaultValue(value *ast.Value) {
+	if value == nil {
+		return
+	}
+	p.space()
+	p.token(lexer.Equals)
+	p.space()
+	p.value(value)
+}
+
+func (p *printer) directives(directives ast.DirectiveList) {
+	for _, directive := range directives {
+		p.space()
+		p.token(lexer.At)
+		p.token(lexer.Name)
+		if p.peekKind(0) == lexer.ParenL {
+			p.arguments(directive.Arguments)
+		}
+	}
+}
+
+func (p *printer) arguments(args ast.ArgumentList) {
+	p.list(lexer.ParenL, lexer.ParenR, len(args), false, func(i int) {
+		p.token(lexer.Name)
+		p.token(lexer.Colon)
+		p.space()
+		p.value(args[i].Value)
+	})
+}
+
+func (p *printer) value(value *ast.Value) {
+	switch value.Kind {
+	case ast.Variable:
+		p.token(lexer.Dollar)
+		p.token(lexer.Name)
+	case ast.IntValue:
+		p.token(lexer.Int)
+	case ast.FloatValue:
+		p.token(lexer.Float)
+	case ast.StringValue:
+		p.token(lexer.String)
+	case ast.BlockValue:
+		p.token(lexer.BlockString)
+	case ast.ListValue:
+		p.list(lexer.BracketL, lexer.BracketR, len(value.Children), false, func(i int) {
+			p.value(value.Children[i].Value)
+		})
+	case ast.ObjectValue:
+		p.list(lexer.BraceL, lexer.BraceR, len(value.Children), true, func(i int) {
+			p.token(lexer.Name)
+			p.token(lexer.Colon)
+			p.space()
+			p.value(value.Children[i].Value)
+		})
+	default:
+		p.token(lexer.Name)
+	}
+}
+
+// Executable documents.
+
+func (p *printer) queryDocument(doc *ast.QueryDocument) {
+	var nodes []printNode
+	for _, op := range doc.Operations {
+		nodes = append(nodes, printNode{op.Position.Start, func() { p.operation(op) }})
+	}
+	for _, def := range doc.Fragments {
+		nodes = append(nodes, printNode{def.Position.Start, func() { p.fragment(def) }})
+	}
+	p.nodes(nodes)
+}
+
+func (p *printer) operation(op *ast.OperationDefinition) {
+	if p.peekKind(0) != lexer.BraceL {
+		p.token(lexer.Name)
+		if p.peekKind(0) == lexer.Name {
+			p.space()
+			p.token(lexer.Name)
+		}
+		if p.peekKind(0) == lexer.ParenL {
+			if op.Name == "" {
+				p.space()
+			}
+			p.variableDefinitions(op.VariableDefinitions)
+		}
+		p.directives(op.Directives)
+		p.space()
+	}
+	p.selectionSet(op.SelectionSet)
+}
+
+func (p *printer) fragment(def *ast.FragmentDefinition) {
+	p.keyword("fragment")
+	p.space()
+	p.token(lexer.Name)
+	if p.peekKind(0) == lexer.ParenL {
+		p.variableDefinitions(def.VariableDefinition)
+	}
+	p.space()
+	p.keyword("on")
+	p.space()
+	p.token(lexer.Name)
+	p.directives(def.Directives)
+	p.space()
+	p.selectionSet(def.SelectionSet)
+}
+
+func (p *printer) variableDefinitions(defs ast.VariableDefinitionList) {
+	p.list(lexer.ParenL, lexer.ParenR, len(defs), false, func(i int) {
+		def := defs[i]
+		p.token(lexer.Dollar)
+		p.token(lexer.Name)
+		p.token(lexer.Colon)
+		p.space()
+		p.typeRef(def.Type)
+		p.defaultValue(def.DefaultValue)
+		p.directives(def.Directives)
+	})
+}
+
+func (p *printer) selectionSet(set ast.SelectionSet) {
+	p.block(len(set), func(i int) {
+		p.selection(set[i])
+	})
+}
+
+func (p *printer) selection(selection ast.Selection) {
+	switch selection := selection.(type) {
+	case *ast.Field:
+		if p.peekKind(1) == lexer.Colon {
+			p.token(lexer.Name)
+			p.token(lexer.Colon)
+			p.space()
+		}
+		p.token(lexer.Name)
+		if p.peekKind(0) == lexer.ParenL {
+			p.arguments(selection.Arguments)
+		}
+		p.directives(selection.Directives)
+		if p.peekKind(0) == lexer.BraceL {
+			p.space()
+			p.selectionSet(selection.SelectionSet)
+		}
+	case *ast.FragmentSpread:
+		p.token(lexer.Spread)
+		p.token(lexer.Name)
+		p.directives(selection.Directives)
+	case *ast.InlineFragment:
+		p.token(lexer.Spread)
+		if p.peekKeyword("on") {
+			p.space()
+			p.token(lexer.Name)
+			p.space()
+			p.token(lexer.Name)
+		}
+		p.directives(selection.Directives)
+		p.space()
+		p.selectionSet(selection.SelectionSet)
+	}
+}
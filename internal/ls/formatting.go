@@ -0,0 +1,291 @@
+package ls
+
+import (
+	"log/slog"
+	"math"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// printWidthOption is a formatting option, next to the standard ones, that
+// overrides the print width for a single request.
+const printWidthOption = "printWidth"
+
+// maxDiffEdits bounds the edit distance lineDiff searches for; larger
+// changes are replaced as one block.
+const maxDiffEdits = 1000
+
+func (s *Server) formatting(_ *glsp.Context, params *protocol.DocumentFormattingParams) ([]protocol.TextEdit, error) {
+	uri := params.TextDocument.URI
+	text, formatted, ok := s.formatText(uri, params.Options)
+	if !ok {
+		return nil, nil
+	}
+	return lineEdits(text, formatted, 0, math.MaxInt), nil
+}
+
+func (s *Server) rangeFormatting(_ *glsp.Context, params *protocol.DocumentRangeFormattingParams) ([]protocol.TextEdit, error) {
+	uri := params.TextDocument.URI
+	text, formatted, ok := s.formatText(uri, params.Options)
+	if !ok {
+		return nil, nil
+	}
+	first := int(params.Range.Start.Line)
+	last := int(params.Range.End.Line)
+	if last > first && params.Range.End.Character == 0 {
+		last--
+	}
+	// Format whole definitions so a partial selection is not left half
+	// reindented.
+	for _, r := range s.definitionRanges(uri, text) {
+		if int(r.Start.Line) <= last && int(r.End.Line) >= first {
+			first = min(first, int(r.Start.Line))
+			last = max(last, int(r.End.Line))
+		}
+	}
+	return lineEdits(text, formatted, first, last), nil
+}
+
+// formatText returns the text of uri and its formatted version.
+func (s *Server) formatText(uri protocol.DocumentUri, options protocol.FormattingOptions) (string, string, bool) {
+	if isIntrospectionURI(uri) {
+		return "", "", false
+	}
+	text, ok := s.documentText(uri)
+	if !ok {
+		return "", "", false
+	}
+	formatted, err := formatDocument(text, s.isSchemaDocument(uri, text), s.formatOptions(options))
+	if err != nil {
+		slog.Debug("formatting failed", "uri", uri, "error", err)
+		return "", "", false
+	}
+	return text, formatted, true
+}
+
+func (s *Server) isSchemaDocument(uri protocol.DocumentUri, text string) bool {
+	return s.isSchemaURI(uri) || !isExecutableDocument(text)
+}
+
+func (s *Server) formatOptions(options protocol.FormattingOptions) formatOptions {
+	s.state.mu.Lock()
+	width := s.state.printWidth
+	s.state.mu.Unlock()
+
+	result := defaultFormatOptions()
+	if width > 0 {
+		result.width = width
+	}
+	if n, ok := formattingInt(options[printWidthOption]); ok && n > 0 {
+		result.width = n
+	}
+	if n, ok := formattingInt(options[protocol.FormattingOptionTabSize]); ok && n > 0 {
+		result.tabSize = n
+	}
+	result.indent = strings.Repeat(" ", result.tabSize)
+	if insertSpaces, ok := options[protocol.FormattingOptionInsertSpaces].(bool); ok && !insertSpaces {
+		result.indent = "\t"
+	}
+	return result
+}
+
+func formattingInt(value any) (int, bool) {
+	switch value := value.(type) {
+	case float64:
+		return int(value), true
+	case int:
+		return value, true
+	case protocol.UInteger:
+		return int(value), true
+	case protocol.Integer:
+		return int(value), true
+	default:
+		return 0, false
+	}
+}
+
+// definitionRanges returns the full ranges of the top-level definitions of
+// text.
+func (s *Server) definitionRanges(uri protocol.DocumentUri, text string) []protocol.Range {
+	source := &ast.Source{
+		Name:  string(uri),
+		Input: text,
+	}
+	var symbols []protocol.DocumentSymbol
+	if s.isSchemaDocument(uri, text) {
+		doc, err := parser.ParseSchema(source)
+		if err != nil {
+			return nil
+		}
+		symbols = schemaDocumentSymbols(doc, newSymbolTokens(source))
+	} else {
+		doc, err := parser.ParseQuery(source)
+		if err != nil {
+			return nil
+		}
+		symbols = queryDocumentSymbols(doc, newSymbolTokens(source))
+	}
+	ranges := make([]protocol.Range, 0, len(symbols))
+	for _, symbol := range symbols {
+		ranges = append(ranges, symbol.Range)
+	}
+	return ranges
+}
+
+// lineEdits returns one edit per run of changed lines between text and
+// formatted, keeping the runs that touch lines first through last of text.
+func lineEdits(text, formatted string, first, last int) []protocol.TextEdit {
+	a := splitLines(text)
+	b := splitLines(formatted)
+	edits := make([]protocol.TextEdit, 0)
+	for _, hunk := range lineDiff(a, b) {
+		touched := hunk.aStart <= last && max(hunk.aEnd-1, hunk.aStart) >= first
+		if !touched {
+			continue
+		}
+		edits = append(edits, protocol.TextEdit{
+			Range: protocol.Range{
+				Start: lineStartPosition(a, hunk.aStart),
+				End:   lineStartPosition(a, hunk.aEnd),
+			},
+			NewText: strings.Join(b[hunk.bStart:hunk.bEnd], ""),
+		})
+	}
+	return edits
+}
+
+// splitLines splits text after each newline.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineStartPosition returns the position where line i of lines starts, or
+// the end of the text past the last line.
+func lineStartPosition(lines []string, i int) protocol.Position {
+	if i == len(lines) && i > 0 && !strings.HasSuffix(lines[i-1], "\n") {
+		return protocol.Position{
+			Line:      protocol.UInteger(i - 1),
+			Character: protocol.UInteger(len(utf16.Encode([]rune(lines[i-1])))),
+		}
+	}
+	return protocol.Position{Line: protocol.UInteger(i)}
+}
+
+// lineHunk replaces lines aStart to aEnd of the old text with lines bStart to
+// bEnd of the new one.
+type lineHunk struct {
+	aStart, aEnd int
+	bStart, bEnd int
+}
+
+// lineDiff returns the hunks of a shortest edit script from a to b, found
+// with Myers' algorithm.
+func lineDiff(a, b []string) []lineHunk {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a = a[prefix : len(a)-suffix]
+	b = b[prefix : len(b)-suffix]
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	whole := []lineHunk{{prefix, prefix + len(a), prefix, prefix + len(b)}}
+
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace[d] holds v[-d..d] as it was before step d.
+	var trace [][]int
+	found := false
+	for d := 0; d <= min(n+m, maxDiffEdits) && !found; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return whole
+	}
+
+	// Walk back from the end, collecting the lines each step inserts or
+	// deletes.
+	inserted := make([]bool, m)
+	deleted := make([]bool, n)
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d]
+		at := func(k int) int { return prev[k+d] }
+		k := x - y
+		var prevK int
+		if k == -d || k != d && at(k-1) < at(k+1) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+		}
+		if x == prevX {
+			inserted[prevY] = true
+		} else {
+			deleted[prevX] = true
+		}
+		x, y = prevX, prevY
+	}
+
+	var hunks []lineHunk
+	i, j := 0, 0
+	for i < n || j < m {
+		if i < n && j < m && !deleted[i] && !inserted[j] {
+			i++
+			j++
+			continue
+		}
+		hunk := lineHunk{aStart: i, bStart: j}
+		for i < n && deleted[i] {
+			i++
+		}
+		for j < m && inserted[j] {
+			j++
+		}
+		hunk.aEnd, hunk.bEnd = i, j
+		hunk.aStart += prefix
+		hunk.aEnd += prefix
+		hunk.bStart += prefix
+		hunk.bEnd += prefix
+		hunks = append(hunks, hunk)
+	}
+	return hunks
+}
@@ -0,0 +1,183 @@
+package ls
+
+import (
+	"log/slog"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// indexProjectDocuments indexes the fragments and named operations of the
+// executable documents of p.
+func (s *Server) indexProjectDocuments(p *project) {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	var operations []*ast.OperationDefinition
+	for _, source := range s.collectDocumentSources(p) {
+		doc, err := s.state.index.queryDocument(source)
+		if err != nil {
+			continue
+		}
+		for _, op := range doc.Operations {
+			if op.Name != "" {
+				operations = append(operations, op)
+			}
+		}
+		for _, fragment := range doc.Fragments {
+			if _, ok := fragments[fragment.Name]; ok {
+				continue
+			}
+			fragments[fragment.Name] = fragment
+		}
+	}
+
+	s.state.mu.Lock()
+	p.fragments = fragments
+	p.operations = operations
+	s.state.mu.Unlock()
+	slog.Debug("document index updated", "project", p.name, "fragments", len(fragments), "operations", len(operations))
+}
+
+// workspaceFragments returns the fragment index of the project owning uri,
+// overlaid with the fragments declared in doc, which always win over indexed
+// copies.
+func (s *Server) workspaceFragments(uri protocol.DocumentUri, doc *ast.QueryDocument) map[string]*ast.FragmentDefinition {
+	p := s.projectForURI(uri)
+	s.state.mu.Lock()
+	fragments := make(map[string]*ast.FragmentDefinition, len(p.fragments))
+	for name, fragment := range p.fragments {
+		fragments[name] = fragment
+	}
+	s.state.mu.Unlock()
+
+	if doc != nil {
+		for _, fragment := range doc.Fragments {
+			fragments[fragment.Name] = fragment
+		}
+	}
+	return fragments
+}
+
+// withReferencedFragments returns a shallow copy of doc that also contains
+// every fragment reachable from its spreads but declared in other documents.
+func withReferencedFragments(doc *ast.QueryDocument, fragments map[string]*ast.FragmentDefinition) *ast.QueryDocument {
+	if doc == nil {
+		return nil
+	}
+	out := *doc
+	out.Fragments = append(ast.FragmentDefinitionList{}, doc.Fragments...)
+
+	known := make(map[string]struct{}, len(doc.Fragments))
+	queue := make([]ast.SelectionSet, 0, len(doc.Operations)+len(doc.Fragments))
+	for _, fragment := range doc.Fragments {
+		known[fragment.Name] = struct{}{}
+		queue = append(queue, fragment.SelectionSet)
+	}
+	for _, op := range doc.Operations {
+		queue = append(queue, op.SelectionSet)
+	}
+
+	for len(queue) > 0 {
+		set := queue[0]
+		queue = queue[1:]
+		for _, name := range fragmentSpreadNames(set) {
+			if _, ok := known[name]; ok {
+				continue
+			}
+			fragment := fragments[name]
+			if fragment == nil {
+				continue
+			}
+			known[name] = struct{}{}
+			out.Fragments = append(out.Fragments, fragment)
+			queue = append(queue, fragment.SelectionSet)
+		}
+	}
+	return &out
+}
+
+func fragmentSpreadNames(set ast.SelectionSet) []string {
+	var names []string
+	for _, selection := range set {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			names = append(names, fragmentSpreadNames(sel.SelectionSet)...)
+		case *ast.InlineFragment:
+			names = append(names, fragmentSpreadNames(sel.SelectionSet)...)
+		case *ast.FragmentSpread:
+			names = append(names, sel.Name)
+		}
+	}
+	return names
+}
+
+// fragmentSpreads returns the fragment spreads in set, including those in
+// nested selection sets.
+func fragmentSpreads(set ast.SelectionSet) []*ast.FragmentSpread {
+	var spreads []*ast.FragmentSpread
+	for _, selection := range set {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			spreads = append(spreads, fragmentSpreads(sel.SelectionSet)...)
+		case *ast.InlineFragment:
+			spreads = append(spreads, fragmentSpreads(sel.SelectionSet)...)
+		case *ast.FragmentSpread:
+			spreads = append(spreads, sel)
+		}
+	}
+	return spreads
+}
+
+func findFragmentSpreadAtPosition(doc *ast.QueryDocument, offset, line, column int) *ast.FragmentSpread {
+	if doc == nil {
+		return nil
+	}
+	for _, op := range doc.Operations {
+		if spread := findFragmentSpreadInSelectionSet(op.SelectionSet, offset, line, column); spread != nil {
+			return spread
+		}
+	}
+	for _, fragment := range doc.Fragments {
+		if spread := findFragmentSpreadInSelectionSet(fragment.SelectionSet, offset, line, column); spread != nil {
+			return spread
+		}
+	}
+	return nil
+}
+
+func findFragmentSpreadInSelectionSet(set ast.SelectionSet, offset, line, column int) *ast.FragmentSpread {
+	for _, selection := range set {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			if spread := findFragmentSpreadInSelectionSet(sel.SelectionSet, offset, line, column); spread != nil {
+				return spread
+			}
+		case *ast.InlineFragment:
+			if spread := findFragmentSpreadInSelectionSet(sel.SelectionSet, offset, line, column); spread != nil {
+				return spread
+			}
+		case *ast.FragmentSpread:
+			if fieldMatchesPosition(sel.Position, offset, line, column, sel.Name) {
+				return sel
+			}
+		}
+	}
+	return nil
+}
+
+func fragmentDefinitionLocation(fragment *ast.FragmentDefinition) *protocol.Location {
+	if fragment == nil {
+		return nil
+	}
+	return locationFromDefinition(fragment.Name, namePositionAfterKeyword(fragment.Position, "fragment"))
+}
+
+func fragmentHover(fragment *ast.FragmentDefinition) *HoverInfo {
+	if fragment == nil {
+		return nil
+	}
+	return &HoverInfo{
+		Name:       fragment.Name,
+		TypeString: fragment.TypeCondition,
+		Signature:  "fragment " + fragment.Name + " on " + fragment.TypeCondition,
+	}
+}
@@ -0,0 +1,141 @@
+package ls
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+var globCache sync.Map
+
+// matchGlob reports whether path matches a slash-separated glob pattern.
+// Besides the filepath.Match syntax it understands `**` for any number of
+// directories and `{a,b}` alternatives, as used by graphql-config.
+func matchGlob(pattern, path string) bool {
+	re := compileGlob(filepath.ToSlash(pattern))
+	if re == nil {
+		return false
+	}
+	return re.MatchString(filepath.ToSlash(path))
+}
+
+func compileGlob(pattern string) *regexp.Regexp {
+	if cached, ok := globCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp)
+	}
+	var b strings.Builder
+	b.WriteByte('^')
+	inBraces := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end == -1 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		case '{':
+			inBraces = true
+			b.WriteString("(?:")
+		case '}':
+			if !inBraces {
+				b.WriteString(`\}`)
+				continue
+			}
+			inBraces = false
+			b.WriteByte(')')
+		case ',':
+			if inBraces {
+				b.WriteByte('|')
+				continue
+			}
+			b.WriteByte(',')
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteByte('$')
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil
+	}
+	globCache.Store(pattern, re)
+	return re
+}
+
+// globBase returns the longest leading directory of pattern that contains no
+// glob syntax, which is where a walk for matching files has to start.
+func globBase(pattern string) string {
+	slashed := filepath.ToSlash(pattern)
+	index := strings.IndexAny(slashed, "*?[{")
+	if index == -1 {
+		return filepath.Dir(pattern)
+	}
+	base := slashed[:index]
+	if cut := strings.LastIndexByte(base, '/'); cut >= 0 {
+		base = base[:cut]
+	} else {
+		base = "."
+	}
+	if base == "" {
+		base = "/"
+	}
+	return filepath.FromSlash(base)
+}
+
+func expandRecursiveGlob(pattern string) []string {
+	var matches []string
+	base := globBase(pattern)
+	stats := newScanStats()
+	err := filepath.WalkDir(base, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if path != base && shouldSkipDir(entry.Name()) {
+				return filepath.SkipDir
+			}
+			if exceedsMaxDepth(base, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if matchGlob(pattern, path) {
+			matches = append(matches, path)
+			stats.fileCount++
+			if stats.fileCount >= maxSchemaFiles {
+				return errStopScan
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errStopScan) {
+		slog.Debug("glob expansion stopped", "pattern", pattern, "files", stats.fileCount)
+	}
+	return matches
+}
@@ -22,15 +22,15 @@ func (s *Server) hover(_ *glsp.Context, params *protocol.HoverParams) (*protocol
 	uri := params.TextDocument.URI
 	s.state.mu.Lock()
 	text, ok := s.state.docs[uri]
-	schema := s.state.schema
 	s.state.mu.Unlock()
+	schema := s.schemaForURI(uri)
 	if ok {
 		_, line, column := PositionToRuneOffset(text, params.Position)
 		slog.Debug("hover request", "uri", uri, "line", line, "column", column)
 	} else {
 		slog.Debug("hover request", "uri", uri, "line", int(params.Position.Line)+1, "column", int(params.Position.Character)+1)
 	}
-	if !ok || schema == nil {
+	if !ok || schema == nil || isIntrospectionURI(uri) {
 		return nil, nil
 	}
 
@@ -61,6 +61,14 @@ func (s *Server) hover(_ *glsp.Context, params *protocol.HoverParams) (*protocol
 	}
 
 	offset, line, column := PositionToRuneOffset(text, params.Position)
+	if spread := findFragmentSpreadAtPosition(doc, offset, line, column); spread != nil {
+		fragments := s.workspaceFragments(uri, doc)
+		if info := fragmentHover(fragments[spread.Name]); info != nil {
+			return hoverFromInfo(info), nil
+		}
+		slog.Debug("hover: fragment not found", "uri", uri, "fragment", spread.Name)
+		return nil, nil
+	}
 	info := FindFieldHover(doc, schema, offset, line, column)
 	if info == nil {
 		slog.Debug("hover: no field info", "uri", uri, "line", line, "column", column)
@@ -75,17 +83,21 @@ func FindFieldHover(doc *ast.QueryDocument, schema *ast.Schema, offset, line, co
 		return nil
 	}
 
-	fragments := make(map[string]*ast.FragmentDefinition, len(doc.Fragments))
-	for _, fragment := range doc.Fragments {
-		fragments[fragment.Name] = fragment
-	}
-
 	for _, op := range doc.Operations {
 		root := rootTypeForOperation(schema, op.Operation)
 		if root == nil {
 			continue
 		}
-		if info := findFieldInSelectionSet(op.SelectionSet, schema, root, fragments, offset, line, column); info != nil {
+		if info := findFieldInSelectionSet(op.SelectionSet, schema, root, offset, line, column); info != nil {
+			return info
+		}
+	}
+	for _, fragment := range doc.Fragments {
+		root := schema.Types[fragment.TypeCondition]
+		if root == nil {
+			continue
+		}
+		if info := findFieldInSelectionSet(fragment.SelectionSet, schema, root, offset, line, column); info != nil {
 			return info
 		}
 	}
@@ -345,7 +357,7 @@ func rootTypeForOperation(schema *ast.Schema, operation ast.Operation) *ast.Defi
 	}
 }
 
-func findFieldInSelectionSet(set ast.SelectionSet, schema *ast.Schema, parent *ast.Definition, fragments map[string]*ast.FragmentDefinition, offset, line, column int) *HoverInfo {
+func findFieldInSelectionSet(set ast.SelectionSet, schema *ast.Schema, parent *ast.Definition, offset, line, column int) *HoverInfo {
 	if parent == nil {
 		return nil
 	}
@@ -369,7 +381,7 @@ func findFieldInSelectionSet(set ast.SelectionSet, schema *ast.Schema, parent *a
 				continue
 			}
 			nextParent := schema.Types[def.Type.Name()]
-			if info := findFieldInSelectionSet(sel.SelectionSet, schema, nextParent, fragments, offset, line, column); info != nil {
+			if info := findFieldInSelectionSet(sel.SelectionSet, schema, nextParent, offset, line, column); info != nil {
 				return info
 			}
 		case *ast.InlineFragment:
@@ -379,21 +391,7 @@ func findFieldInSelectionSet(set ast.SelectionSet, schema *ast.Schema, parent *a
 					nextParent = def
 				}
 			}
-			if info := findFieldInSelectionSet(sel.SelectionSet, schema, nextParent, fragments, offset, line, column); info != nil {
-				return info
-			}
-		case *ast.FragmentSpread:
-			fragment := fragments[sel.Name]
-			if fragment == nil {
-				continue
-			}
-			nextParent := parent
-			if fragment.TypeCondition != "" {
-				if def := schema.Types[fragment.TypeCondition]; def != nil {
-					nextParent = def
-				}
-			}
-			if info := findFieldInSelectionSet(fragment.SelectionSet, schema, nextParent, fragments, offset, line, column); info != nil {
+			if info := findFieldInSelectionSet(sel.SelectionSet, schema, nextParent, offset, line, column); info != nil {
 				return info
 			}
 		}
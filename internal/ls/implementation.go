@@ -0,0 +1,98 @@
+package ls
+
+import (
+	"log/slog"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func (s *Server) implementation(_ *glsp.Context, params *protocol.ImplementationParams) (any, error) {
+	uri := params.TextDocument.URI
+
+	schema := s.schemaForURI(uri)
+	if schema == nil {
+		slog.Debug("implementation: schema not loaded", "uri", uri)
+		return nil, nil
+	}
+
+	text, ok := s.documentText(uri)
+	if !ok {
+		return nil, nil
+	}
+
+	offset, line, column := PositionToRuneOffset(text, params.Position)
+	p := s.projectForURI(uri)
+	var locations []protocol.Location
+	if s.isSchemaURI(uri) {
+		if member := schemaMemberAtOffset(uri, text, offset); member != nil {
+			if member.argument != "" {
+				return nil, nil
+			}
+			locations = s.fieldImplementations(p, schema, member.typeName, member.name)
+		} else {
+			locations = typeImplementations(schema, definitionTargetAtPosition(text, line, column))
+		}
+	} else {
+		doc, err := s.state.index.queryDocument(&ast.Source{Name: string(uri), Input: text})
+		if err != nil {
+			return nil, nil
+		}
+		for _, name := range queryNames(doc, schema) {
+			if !name.covers(offset) {
+				continue
+			}
+			if name.kind == queryNameField && name.parent != nil && name.field != nil {
+				locations = s.fieldImplementations(p, schema, name.parent.Name, name.field.Name)
+			} else if name.kind == queryNameType && name.typeDef != nil {
+				locations = typeImplementations(schema, name.typeDef.Name)
+			}
+			break
+		}
+	}
+	if len(locations) == 0 {
+		slog.Debug("implementation: no matches", "uri", uri, "line", line, "column", column)
+		return nil, nil
+	}
+	return locations, nil
+}
+
+// typeImplementations returns the types implementing the interface named
+// target, or the members of the union named target.
+func typeImplementations(schema *ast.Schema, target string) []protocol.Location {
+	def := schema.Types[target]
+	if def == nil || def.Kind != ast.Interface && def.Kind != ast.Union {
+		return nil
+	}
+	locations := make([]protocol.Location, 0)
+	for _, possible := range schema.PossibleTypes[target] {
+		if possible == nil || isBuiltInPosition(possible.Position) {
+			continue
+		}
+		if loc := locationFromDefinition(possible.Name, possible.Position); loc != nil {
+			locations = append(locations, *loc)
+		}
+	}
+	return locations
+}
+
+// fieldImplementations returns the declarations of fieldName on the types
+// implementing the interface typeName.
+func (s *Server) fieldImplementations(p *project, schema *ast.Schema, typeName, fieldName string) []protocol.Location {
+	def := schema.Types[typeName]
+	if def == nil || def.Kind != ast.Interface {
+		return nil
+	}
+	implementers := make(map[string]struct{})
+	for _, possible := range schema.PossibleTypes[typeName] {
+		if possible != nil && possible.Fields.ForName(fieldName) != nil {
+			implementers[possible.Name] = struct{}{}
+		}
+	}
+	if len(implementers) == 0 {
+		return nil
+	}
+	sources, _ := s.collectProjectSchemaSources(p)
+	return findSchemaMemberDeclarationsInSources(sources, implementers, &schemaMember{typeName: typeName, name: fieldName})
+}
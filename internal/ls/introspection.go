@@ -0,0 +1,478 @@
+package ls
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+var errNotIntrospection = errors.New("not an introspection result")
+
+type introspectionResult struct {
+	Data   *introspectionResult `json:"data"`
+	Schema *introspectionSchema `json:"__schema"`
+}
+
+type introspectionSchema struct {
+	Description      *string                  `json:"description"`
+	QueryType        *introspectionNamedType  `json:"queryType"`
+	MutationType     *introspectionNamedType  `json:"mutationType"`
+	SubscriptionType *introspectionNamedType  `json:"subscriptionType"`
+	Types            []introspectionType      `json:"types"`
+	Directives       []introspectionDirective `json:"directives"`
+}
+
+type introspectionNamedType struct {
+	Name string `json:"name"`
+}
+
+type introspectionType struct {
+	Kind           string                    `json:"kind"`
+	Name           string                    `json:"name"`
+	Description    *string                   `json:"description"`
+	SpecifiedByURL *string                   `json:"specifiedByURL"`
+	Fields         []introspectionField      `json:"fields"`
+	InputFields    []introspectionInputValue `json:"inputFields"`
+	Interfaces     []introspectionTypeRef    `json:"interfaces"`
+	EnumValues     []introspectionEnumValue  `json:"enumValues"`
+	PossibleTypes  []introspectionTypeRef    `json:"possibleTypes"`
+}
+
+type introspectionField struct {
+	Name              string                    `json:"name"`
+	Description       *string                   `json:"description"`
+	Args              []introspectionInputValue `json:"args"`
+	Type              introspectionTypeRef      `json:"type"`
+	IsDeprecated      bool                      `json:"isDeprecated"`
+	DeprecationReason *string                   `json:"deprecationReason"`
+}
+
+type introspectionInputValue struct {
+	Name              string               `json:"name"`
+	Description       *string              `json:"description"`
+	Type              introspectionTypeRef `json:"type"`
+	DefaultValue      *string              `json:"defaultValue"`
+	IsDeprecated      bool                 `json:"isDeprecated"`
+	DeprecationReason *string              `json:"deprecationReason"`
+}
+
+type introspectionTypeRef struct {
+	Kind   string                `json:"kind"`
+	Name   *string               `json:"name"`
+	OfType *introspectionTypeRef `json:"ofType"`
+}
+
+type introspectionEnumValue struct {
+	Name              string  `json:"name"`
+	Description       *string `json:"description"`
+	IsDeprecated      bool    `json:"isDeprecated"`
+	DeprecationReason *string `json:"deprecationReason"`
+}
+
+type introspectionDirective struct {
+	Name         string                    `json:"name"`
+	Description  *string                   `json:"description"`
+	Locations    []string                  `json:"locations"`
+	Args         []introspectionInputValue `json:"args"`
+	IsRepeatable bool                      `json:"isRepeatable"`
+}
+
+// introspectionDocument is an introspection result converted to SDL. The
+// positions map schema coordinates (`Type`, `Type.field`, `Type.field(arg)`,
+// `@directive`, `@directive(arg)`) to the `"name"` strings of the JSON file so
+// definitions can point back at it.
+type introspectionDocument struct {
+	sdl       string
+	positions map[string]*ast.Position
+}
+
+func isIntrospectionPath(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".json"
+}
+
+func isIntrospectionURI(uri protocol.DocumentUri) bool {
+	path := uriToPath(uri)
+	if path == "" {
+		return false
+	}
+	return isIntrospectionPath(path)
+}
+
+// parseIntrospection accepts either `{"__schema": ...}` or the full response
+// `{"data": {"__schema": ...}}`.
+func parseIntrospection(uri protocol.DocumentUri, text string) (*introspectionDocument, error) {
+	var result introspectionResult
+	if err := json.Unmarshal([]byte(text), &result); err != nil {
+		return nil, err
+	}
+	prefix := "__schema"
+	schema := result.Schema
+	if schema == nil && result.Data != nil {
+		prefix = "data.__schema"
+		schema = result.Data.Schema
+	}
+	if schema == nil {
+		return nil, errNotIntrospection
+	}
+
+	offsets, err := jsonNameOffsets([]byte(text))
+	if err != nil {
+		return nil, err
+	}
+	src := &ast.Source{
+		Name:  string(uri),
+		Input: text,
+	}
+	positions := make(map[string]*ast.Position)
+	addPosition := func(coordinate, path, name string) {
+		offset, ok := offsets[path]
+		if !ok {
+			return
+		}
+		positions[coordinate] = jsonOffsetPosition(src, offset, name)
+	}
+
+	var b strings.Builder
+	writeSchemaDefinition(&b, schema)
+	for i, def := range schema.Types {
+		if strings.HasPrefix(def.Name, "__") || isBuiltInScalar(def.Name) {
+			continue
+		}
+		typePath := prefix + ".types." + strconv.Itoa(i)
+		addPosition(def.Name, typePath, def.Name)
+		for j, field := range def.Fields {
+			fieldPath := typePath + ".fields." + strconv.Itoa(j)
+			addPosition(def.Name+"."+field.Name, fieldPath, field.Name)
+			for k, arg := range field.Args {
+				addPosition(def.Name+"."+field.Name+"("+arg.Name+")", fieldPath+".args."+strconv.Itoa(k), arg.Name)
+			}
+		}
+		for j, field := range def.InputFields {
+			addPosition(def.Name+"."+field.Name, typePath+".inputFields."+strconv.Itoa(j), field.Name)
+		}
+		for j, value := range def.EnumValues {
+			addPosition(def.Name+"."+value.Name, typePath+".enumValues."+strconv.Itoa(j), value.Name)
+		}
+		writeIntrospectionType(&b, def)
+	}
+	for i, directive := range schema.Directives {
+		if isBuiltInDirective(directive.Name) {
+			continue
+		}
+		directivePath := prefix + ".directives." + strconv.Itoa(i)
+		addPosition("@"+directive.Name, directivePath, directive.Name)
+		for k, arg := range directive.Args {
+			addPosition("@"+directive.Name+"("+arg.Name+")", directivePath+".args."+strconv.Itoa(k), arg.Name)
+		}
+		writeIntrospectionDirective(&b, directive)
+	}
+
+	return &introspectionDocument{
+		sdl:       b.String(),
+		positions: positions,
+	}, nil
+}
+
+func writeSchemaDefinition(b *strings.Builder, schema *introspectionSchema) {
+	if schema.QueryType == nil && schema.MutationType == nil && schema.SubscriptionType == nil {
+		return
+	}
+	writeDescription(b, schema.Description, "")
+	b.WriteString("schema {\n")
+	if schema.QueryType != nil {
+		b.WriteString("  query: " + schema.QueryType.Name + "\n")
+	}
+	if schema.MutationType != nil {
+		b.WriteString("  mutation: " + schema.MutationType.Name + "\n")
+	}
+	if schema.SubscriptionType != nil {
+		b.WriteString("  subscription: " + schema.SubscriptionType.Name + "\n")
+	}
+	b.WriteString("}\n\n")
+}
+
+func writeIntrospectionType(b *strings.Builder, def introspectionType) {
+	writeDescription(b, def.Description, "")
+	switch def.Kind {
+	case "SCALAR":
+		b.WriteString("scalar " + def.Name)
+		if def.SpecifiedByURL != nil {
+			b.WriteString(" @specifiedBy(url: " + graphQLString(*def.SpecifiedByURL) + ")")
+		}
+		b.WriteString("\n\n")
+	case "OBJECT", "INTERFACE":
+		keyword := "type "
+		if def.Kind == "INTERFACE" {
+			keyword = "interface "
+		}
+		b.WriteString(keyword + def.Name)
+		writeImplements(b, def.Interfaces)
+		if len(def.Fields) > 0 {
+			b.WriteString(" {\n")
+			for _, field := range def.Fields {
+				writeDescription(b, field.Description, "  ")
+				b.WriteString("  " + field.Name)
+				writeArgumentDefinitions(b, field.Args)
+				b.WriteString(": " + field.Type.String())
+				writeDeprecated(b, field.IsDeprecated, field.DeprecationReason)
+				b.WriteString("\n")
+			}
+			b.WriteString("}")
+		}
+		b.WriteString("\n\n")
+	case "UNION":
+		b.WriteString("union " + def.Name)
+		for i, member := range def.PossibleTypes {
+			if i == 0 {
+				b.WriteString(" = ")
+			} else {
+				b.WriteString(" | ")
+			}
+			b.WriteString(member.String())
+		}
+		b.WriteString("\n\n")
+	case "ENUM":
+		b.WriteString("enum " + def.Name + " {\n")
+		for _, value := range def.EnumValues {
+			writeDescription(b, value.Description, "  ")
+			b.WriteString("  " + value.Name)
+			writeDeprecated(b, value.IsDeprecated, value.DeprecationReason)
+			b.WriteString("\n")
+		}
+		b.WriteString("}\n\n")
+	case "INPUT_OBJECT":
+		b.WriteString("input " + def.Name + " {\n")
+		for _, field := range def.InputFields {
+			writeDescription(b, field.Description, "  ")
+			b.WriteString("  ")
+			writeInputValue(b, field)
+			b.WriteString("\n")
+		}
+		b.WriteString("}\n\n")
+	}
+}
+
+func writeIntrospectionDirective(b *strings.Builder, directive introspectionDirective) {
+	writeDescription(b, directive.Description, "")
+	b.WriteString("directive @" + directive.Name)
+	writeArgumentDefinitions(b, directive.Args)
+	if directive.IsRepeatable {
+		b.WriteString(" repeatable")
+	}
+	b.WriteString(" on " + strings.Join(directive.Locations, " | ") + "\n\n")
+}
+
+func writeImplements(b *strings.Builder, interfaces []introspectionTypeRef) {
+	for i, iface := range interfaces {
+		if i == 0 {
+			b.WriteString(" implements ")
+		} else {
+			b.WriteString(" & ")
+		}
+		b.WriteString(iface.String())
+	}
+}
+
+func writeArgumentDefinitions(b *strings.Builder, args []introspectionInputValue) {
+	if len(args) == 0 {
+		return
+	}
+	b.WriteByte('(')
+	for i, arg := range args {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		if arg.Description != nil && *arg.Description != "" {
+			b.WriteString(graphQLString(*arg.Description) + " ")
+		}
+		writeInputValue(b, arg)
+	}
+	b.WriteByte(')')
+}
+
+func writeInputValue(b *strings.Builder, value introspectionInputValue) {
+	b.WriteString(value.Name + ": " + value.Type.String())
+	if value.DefaultValue != nil {
+		b.WriteString(" = " + *value.DefaultValue)
+	}
+	writeDeprecated(b, value.IsDeprecated, value.DeprecationReason)
+}
+
+func writeDescription(b *strings.Builder, description *string, indent string) {
+	if description == nil || *description == "" {
+		return
+	}
+	b.WriteString(indent + graphQLString(*description) + "\n")
+}
+
+func writeDeprecated(b *strings.Builder, deprecated bool, reason *string) {
+	if !deprecated {
+		return
+	}
+	b.WriteString(" @deprecated")
+	if reason != nil {
+		b.WriteString("(reason: " + graphQLString(*reason) + ")")
+	}
+}
+
+// graphQLString quotes s as a GraphQL string. JSON string escapes are a
+// subset of the GraphQL ones.
+func graphQLString(s string) string {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return `""`
+	}
+	return string(data)
+}
+
+func (t introspectionTypeRef) String() string {
+	switch t.Kind {
+	case "NON_NULL":
+		if t.OfType == nil {
+			return ""
+		}
+		return t.OfType.String() + "!"
+	case "LIST":
+		if t.OfType == nil {
+			return ""
+		}
+		return "[" + t.OfType.String() + "]"
+	default:
+		if t.Name == nil {
+			return ""
+		}
+		return *t.Name
+	}
+}
+
+// jsonNameOffsets returns the byte offset of every `"name"` string value in
+// data, keyed by the dotted path of the object that holds it
+// (for example `__schema.types.3.fields.0`).
+func jsonNameOffsets(data []byte) (map[string]int, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	offsets := make(map[string]int)
+	var walk func(tok json.Token, path string) error
+	walk = func(tok json.Token, path string) error {
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				key, _ := keyTok.(string)
+				valueTok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if name, ok := valueTok.(string); key == "name" && ok {
+					// InputOffset is just past the closing quote.
+					offsets[path] = int(dec.InputOffset()) - len(name) - 1
+					continue
+				}
+				child := key
+				if path != "" {
+					child = path + "." + key
+				}
+				if err := walk(valueTok, child); err != nil {
+					return err
+				}
+			}
+			_, err := dec.Token()
+			return err
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				elemTok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if err := walk(elemTok, path+"."+strconv.Itoa(i)); err != nil {
+					return err
+				}
+			}
+			_, err := dec.Token()
+			return err
+		}
+		return nil
+	}
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	return offsets, walk(tok, "")
+}
+
+func jsonOffsetPosition(src *ast.Source, offset int, name string) *ast.Position {
+	if offset < 0 || offset > len(src.Input) {
+		return nil
+	}
+	prefix := src.Input[:offset]
+	line := strings.Count(prefix, "\n") + 1
+	lineStart := strings.LastIndexByte(prefix, '\n') + 1
+	start := utf8.RuneCountInString(prefix)
+	return &ast.Position{
+		Start:  start,
+		End:    start + utf8.RuneCountInString(name),
+		Line:   line,
+		Column: utf8.RuneCountInString(prefix[lineStart:]) + 1,
+		Src:    src,
+	}
+}
+
+// remapIntrospectionPositions points definitions loaded from converted
+// introspection results at the matching names in the original JSON files.
+func remapIntrospectionPositions(schema *ast.Schema, docs map[protocol.DocumentUri]*introspectionDocument) {
+	if schema == nil || len(docs) == 0 {
+		return
+	}
+	lookup := func(pos *ast.Position, coordinate string) *ast.Position {
+		if pos == nil || pos.Src == nil {
+			return pos
+		}
+		doc := docs[protocol.DocumentUri(pos.Src.Name)]
+		if doc == nil {
+			return pos
+		}
+		if mapped := doc.positions[coordinate]; mapped != nil {
+			return mapped
+		}
+		return pos
+	}
+	for _, def := range schema.Types {
+		def.Position = lookup(def.Position, def.Name)
+		for _, field := range def.Fields {
+			field.Position = lookup(field.Position, def.Name+"."+field.Name)
+			for _, arg := range field.Arguments {
+				arg.Position = lookup(arg.Position, def.Name+"."+field.Name+"("+arg.Name+")")
+			}
+		}
+		for _, value := range def.EnumValues {
+			value.Position = lookup(value.Position, def.Name+"."+value.Name)
+		}
+	}
+	for _, directive := range schema.Directives {
+		directive.Position = lookup(directive.Position, "@"+directive.Name)
+		for _, arg := range directive.Arguments {
+			arg.Position = lookup(arg.Position, "@"+directive.Name+"("+arg.Name+")")
+		}
+	}
+}
+
+func (s *Server) introspectionDocuments(uris map[protocol.DocumentUri]struct{}) map[protocol.DocumentUri]*introspectionDocument {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	docs := make(map[protocol.DocumentUri]*introspectionDocument)
+	for uri := range uris {
+		if doc := s.state.introspection[uri]; doc != nil {
+			docs[uri] = doc
+		}
+	}
+	return docs
+}
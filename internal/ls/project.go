@@ -0,0 +1,158 @@
+package ls
+
+import (
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// allProjects returns the default project followed by the named projects in
+// name order.
+func (s *Server) allProjects() []*project {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	projects := []*project{&s.state.project}
+	return append(projects, s.sortedNamedProjects()...)
+}
+
+// sortedNamedProjects must be called with s.state.mu held.
+func (s *Server) sortedNamedProjects() []*project {
+	projects := make([]*project, 0, len(s.state.projects))
+	for _, p := range s.state.projects {
+		projects = append(projects, p)
+	}
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].name < projects[j].name
+	})
+	return projects
+}
+
+// projectForURI routes a document to the project that owns it: a named
+// project that loaded it as schema, then the first named project whose
+// documents/include globs match it, and otherwise the default project.
+func (s *Server) projectForURI(uri protocol.DocumentUri) *project {
+	path := uriToPath(uri)
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	named := s.sortedNamedProjects()
+	for _, p := range named {
+		if _, ok := p.schemaURIs[uri]; ok {
+			return p
+		}
+	}
+	if path != "" {
+		for _, p := range named {
+			if p.ownsPath(s.state.rootPath, path) {
+				return p
+			}
+		}
+	}
+	return &s.state.project
+}
+
+func (s *Server) schemaForURI(uri protocol.DocumentUri) *ast.Schema {
+	p := s.projectForURI(uri)
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	return p.schema
+}
+
+func (s *Server) hasNamedProjects() bool {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	return len(s.state.projects) > 0
+}
+
+// schemaPatterns returns the schema locations of p. For the default project,
+// editor-provided schemaPaths are combined with the shared config file's
+// schema; sources listed by both are loaded once.
+func (s *Server) schemaPatterns(p *project) []string {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	patterns := append([]string(nil), p.schemaPaths...)
+	if p.config != nil {
+		for _, pattern := range p.config.Schema.patternList {
+			if !slices.Contains(patterns, pattern) {
+				patterns = append(patterns, pattern)
+			}
+		}
+	}
+	return patterns
+}
+
+// endpointOptions returns the config file options of an endpoint listed in
+// the schema of p, or nil when it has none.
+func (s *Server) endpointOptions(p *project, url string) *endpointConfig {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	if p.config == nil {
+		return nil
+	}
+	return p.config.Schema.endpoints[url]
+}
+
+func (s *Server) documentPatterns(p *project) []string {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	if p.config == nil {
+		return nil
+	}
+	return append([]string(nil), p.config.Documents...)
+}
+
+// ownsPath reports whether a named project claims path through its
+// documents or include globs. It must be called with s.state.mu held.
+func (p *project) ownsPath(root, path string) bool {
+	if p.config == nil {
+		return false
+	}
+	patterns := p.config.Documents
+	if len(patterns) == 0 {
+		patterns = p.config.Include
+	}
+	if !matchesAnyPattern(patterns, root, path) {
+		return false
+	}
+	return p.includesPath(root, path)
+}
+
+// includesPath applies the project include/exclude globs, which are relative
+// to the workspace root. It must be called with s.state.mu held.
+func (p *project) includesPath(root, path string) bool {
+	if p.config == nil {
+		return true
+	}
+	if len(p.config.Include) > 0 && !matchesAnyPattern(p.config.Include, root, path) {
+		return false
+	}
+	return !matchesAnyPattern(p.config.Exclude, root, path)
+}
+
+func matchesAnyPattern(patterns []string, root, path string) bool {
+	rel := path
+	if root != "" {
+		if r, err := filepath.Rel(root, path); err == nil {
+			rel = r
+		}
+	}
+	for _, pattern := range patterns {
+		target := rel
+		if filepath.IsAbs(pattern) {
+			target = path
+		}
+		if matchGlob(pattern, target) {
+			return true
+		}
+		if !hasGlobMeta(pattern) && !strings.Contains(pattern, "{") {
+			dir := strings.TrimSuffix(filepath.ToSlash(filepath.Clean(pattern)), "/") + "/"
+			if strings.HasPrefix(filepath.ToSlash(target), dir) {
+				return true
+			}
+		}
+	}
+	return false
+}
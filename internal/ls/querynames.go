@@ -0,0 +1,234 @@
+package ls
+
+import (
+	"unicode/utf8"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+type queryNameKind int
+
+const (
+	queryNameField queryNameKind = iota
+	queryNameArgument
+	queryNameInputField
+	queryNameEnumValue
+	queryNameVariable
+	queryNameType
+	queryNameDirective
+)
+
+// queryName is a name written in an operation document, together with the
+// schema element it refers to. Elements the schema does not declare are
+// left nil.
+type queryName struct {
+	kind queryNameKind
+	pos  *ast.Position
+	// text is the name as written; variables include their `$`.
+	text string
+	// parent is the type declaring a field, input field, or enum value, or
+	// the type of the field an argument is given to.
+	parent    *ast.Definition
+	field     *ast.FieldDefinition
+	argument  *ast.ArgumentDefinition
+	enumValue *ast.EnumValueDefinition
+	directive *ast.DirectiveDefinition
+	// typeDef is the type named by a type condition or variable type.
+	typeDef *ast.Definition
+	// variables are the declarations a variable may refer to: those of its
+	// operation, or of every operation in the document for a fragment.
+	variables ast.VariableDefinitionList
+}
+
+// covers reports whether the name includes the rune offset, counting the
+// position right after it.
+func (n queryName) covers(offset int) bool {
+	return nameCovers(n.pos, n.text, offset)
+}
+
+// nameCovers reports whether text written at pos includes the rune offset,
+// counting the position right after it.
+func nameCovers(pos *ast.Position, text string, offset int) bool {
+	return pos != nil && offset >= pos.Start && offset <= pos.Start+utf8.RuneCountInString(text)
+}
+
+// queryNames lists the names of doc, resolving fields through the types of
+// their selection sets and values through the types they are given for.
+func queryNames(doc *ast.QueryDocument, schema *ast.Schema) []queryName {
+	if doc == nil || schema == nil {
+		return nil
+	}
+	w := &queryNameWalker{schema: schema}
+	for _, op := range doc.Operations {
+		w.vars = op.VariableDefinitions
+		for _, def := range op.VariableDefinitions {
+			w.typeRef(def.Type)
+			w.value(def.DefaultValue, def.Type)
+			w.directives(def.Directives)
+		}
+		w.directives(op.Directives)
+		w.selectionSet(op.SelectionSet, rootTypeForOperation(schema, op.Operation))
+	}
+	w.vars = nil
+	for _, op := range doc.Operations {
+		w.vars = append(w.vars, op.VariableDefinitions...)
+	}
+	for _, fragment := range doc.Fragments {
+		namePos := namePositionAfterKeyword(fragment.Position, "fragment")
+		onPos := namePositionAfterKeyword(namePos, fragment.Name)
+		w.typeName(namePositionAfterKeyword(onPos, "on"), fragment.TypeCondition)
+		w.directives(fragment.Directives)
+		w.selectionSet(fragment.SelectionSet, schema.Types[fragment.TypeCondition])
+	}
+	return w.names
+}
+
+type queryNameWalker struct {
+	schema *ast.Schema
+	vars   ast.VariableDefinitionList
+	names  []queryName
+}
+
+func (w *queryNameWalker) add(name queryName) {
+	if name.pos != nil {
+		w.names = append(w.names, name)
+	}
+}
+
+func (w *queryNameWalker) selectionSet(set ast.SelectionSet, parent *ast.Definition) {
+	for _, selection := range set {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			def := findFieldDefinition(parent, sel.Name)
+			w.add(queryName{kind: queryNameField, pos: fieldNamePosition(sel), text: sel.Name, parent: parent, field: def})
+			var args ast.ArgumentDefinitionList
+			var child *ast.Definition
+			if def != nil {
+				args = def.Arguments
+				child = w.schema.Types[def.Type.Name()]
+			}
+			w.arguments(sel.Arguments, args, parent, def, nil)
+			w.directives(sel.Directives)
+			w.selectionSet(sel.SelectionSet, child)
+		case *ast.FragmentSpread:
+			w.directives(sel.Directives)
+		case *ast.InlineFragment:
+			next := parent
+			if sel.TypeCondition != "" {
+				w.typeName(namePositionAfterKeyword(sel.Position, "on"), sel.TypeCondition)
+				next = w.schema.Types[sel.TypeCondition]
+			}
+			w.directives(sel.Directives)
+			w.selectionSet(sel.SelectionSet, next)
+		}
+	}
+}
+
+// arguments lists the arguments given to field of parent, or to directive.
+func (w *queryNameWalker) arguments(args ast.ArgumentList, defs ast.ArgumentDefinitionList, parent *ast.Definition, field *ast.FieldDefinition, directive *ast.DirectiveDefinition) {
+	for _, arg := range args {
+		def := defs.ForName(arg.Name)
+		w.add(queryName{kind: queryNameArgument, pos: arg.Position, text: arg.Name, parent: parent, field: field, argument: def, directive: directive})
+		var expected *ast.Type
+		if def != nil {
+			expected = def.Type
+		}
+		w.value(arg.Value, expected)
+	}
+}
+
+func (w *queryNameWalker) directives(directives ast.DirectiveList) {
+	for _, directive := range directives {
+		def := w.schema.Directives[directive.Name]
+		w.add(queryName{kind: queryNameDirective, pos: directive.Position, text: directive.Name, directive: def})
+		var defs ast.ArgumentDefinitionList
+		if def != nil {
+			defs = def.Arguments
+		}
+		w.arguments(directive.Arguments, defs, nil, nil, def)
+	}
+}
+
+// value lists the variables, enum values, and input object fields of value,
+// given for a location of the expected type if known.
+func (w *queryNameWalker) value(value *ast.Value, expected *ast.Type) {
+	if value == nil {
+		return
+	}
+	var def *ast.Definition
+	if expected != nil && expected.Elem == nil {
+		def = w.schema.Types[expected.NamedType]
+	}
+	switch value.Kind {
+	case ast.Variable:
+		w.add(queryName{kind: queryNameVariable, pos: value.Position, text: "$" + value.Raw, variables: w.vars})
+	case ast.EnumValue:
+		var enumValue *ast.EnumValueDefinition
+		if def != nil {
+			enumValue = def.EnumValues.ForName(value.Raw)
+		}
+		w.add(queryName{kind: queryNameEnumValue, pos: value.Position, text: value.Raw, parent: def, enumValue: enumValue})
+	case ast.ListValue:
+		var elem *ast.Type
+		if expected != nil {
+			elem = expected.Elem
+		}
+		for _, child := range value.Children {
+			w.value(child.Value, elem)
+		}
+	case ast.ObjectValue:
+		for _, child := range value.Children {
+			var field *ast.FieldDefinition
+			var fieldType *ast.Type
+			if def != nil {
+				if field = def.Fields.ForName(child.Name); field != nil {
+					fieldType = field.Type
+				}
+			}
+			w.add(queryName{kind: queryNameInputField, pos: child.Position, text: child.Name, parent: def, field: field})
+			w.value(child.Value, fieldType)
+		}
+	}
+}
+
+func (w *queryNameWalker) typeRef(t *ast.Type) {
+	if t == nil {
+		return
+	}
+	if t.Elem != nil {
+		w.typeRef(t.Elem)
+		return
+	}
+	w.typeName(t.Position, t.NamedType)
+}
+
+func (w *queryNameWalker) typeName(pos *ast.Position, name string) {
+	w.add(queryName{kind: queryNameType, pos: pos, text: name, typeDef: w.schema.Types[name]})
+}
+
+// fieldNamePosition returns the position of the name of field, which
+// follows its alias if it has one.
+func fieldNamePosition(field *ast.Field) *ast.Position {
+	pos := field.Position
+	if field.Alias == "" || field.Alias == field.Name || pos == nil || pos.Src == nil {
+		return pos
+	}
+	runes := []rune(pos.Src.Input)
+	aliasLen := utf8.RuneCountInString(field.Alias)
+	i := pos.Start + aliasLen
+	line := pos.Line
+	column := pos.Column + aliasLen
+	for i < len(runes) && (runes[i] == ' ' || runes[i] == '\t' || runes[i] == ',' || runes[i] == '\r' || runes[i] == '\n') {
+		if runes[i] == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+		i++
+	}
+	if i >= len(runes) || runes[i] != ':' {
+		return nil
+	}
+	return namePositionAfterKeyword(&ast.Position{Start: i, Line: line, Column: column, Src: pos.Src}, ":")
+}
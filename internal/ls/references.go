@@ -7,15 +7,14 @@ import (
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/lexer"
 	"github.com/vektah/gqlparser/v2/parser"
 )
 
 func (s *Server) references(_ *glsp.Context, params *protocol.ReferenceParams) ([]protocol.Location, error) {
 	uri := params.TextDocument.URI
 
-	s.state.mu.Lock()
-	schema := s.state.schema
-	s.state.mu.Unlock()
+	schema := s.schemaForURI(uri)
 	if schema == nil {
 		slog.Debug("references: schema not loaded", "uri", uri)
 		return nil, nil
@@ -30,7 +29,25 @@ func (s *Server) references(_ *glsp.Context, params *protocol.ReferenceParams) (
 		return nil, nil
 	}
 
-	_, line, column := PositionToRuneOffset(text, params.Position)
+	offset, line, column := PositionToRuneOffset(text, params.Position)
+	p := s.projectForURI(uri)
+	if member := schemaMemberAtOffset(uri, text, offset); member != nil {
+		locations := make([]protocol.Location, 0)
+		if params.Context.IncludeDeclaration && member.declaration != nil {
+			locations = append(locations, *member.declaration)
+		}
+		if def := schema.Types[member.typeName]; def != nil && def.Kind == ast.Enum {
+			sources, _ := s.collectProjectSchemaSources(p)
+			locations = append(locations, findSchemaEnumValueReferencesInSources(sources, schema, member.typeName, member.name, false)...)
+		}
+		locations = append(locations, s.findOperationReferences(p, schema, member.matches)...)
+		if len(locations) == 0 {
+			slog.Debug("references: no matches", "uri", uri, "line", line, "column", column, "target", member.typeName+"."+member.name)
+			return nil, nil
+		}
+		return locations, nil
+	}
+
 	target := definitionTargetAtPosition(text, line, column)
 	if target == "" || (schema.Types[target] == nil && !isBuiltInScalar(target)) {
 		if alt := typeNameAtLinePosition(text, line, column); alt != "" {
@@ -42,8 +59,11 @@ func (s *Server) references(_ *glsp.Context, params *protocol.ReferenceParams) (
 		return nil, nil
 	}
 
-	sources, _ := s.collectSchemaSources()
+	sources, _ := s.collectProjectSchemaSources(p)
 	locations := findSchemaTypeReferencesInSources(sources, target, params.Context.IncludeDeclaration)
+	locations = append(locations, s.findOperationReferences(p, schema, func(name queryName) bool {
+		return name.kind == queryNameType && name.typeDef != nil && name.typeDef.Name == target
+	})...)
 	if len(locations) == 0 {
 		slog.Debug("references: no matches", "uri", uri, "line", line, "column", column, "target", target)
 		return nil, nil
@@ -51,6 +71,96 @@ func (s *Server) references(_ *glsp.Context, params *protocol.ReferenceParams) (
 	return locations, nil
 }
 
+// schemaMember identifies a field, input field, enum value, or field
+// argument declared in SDL.
+type schemaMember struct {
+	typeName string
+	// name is the field, input field, or enum value.
+	name string
+	// argument is set for arguments of the field.
+	argument    string
+	declaration *protocol.Location
+}
+
+// schemaMemberAtOffset returns the member whose declared name covers the rune
+// offset of a schema document.
+func schemaMemberAtOffset(uri protocol.DocumentUri, text string, offset int) *schemaMember {
+	source := &ast.Source{
+		Name:  string(uri),
+		Input: text,
+	}
+	doc, err := parser.ParseSchema(source)
+	if err != nil {
+		return nil
+	}
+	t := newSymbolTokens(source)
+	i := t.tokenAt(offset)
+	if t.kindAt(i) != lexer.Name {
+		return nil
+	}
+	nameAt := func(pos *ast.Position) bool {
+		return t.skipDescription(t.index(pos)) == i
+	}
+	defs := append(ast.DefinitionList{}, doc.Definitions...)
+	defs = append(defs, doc.Extensions...)
+	for _, def := range defs {
+		for _, field := range def.Fields {
+			if nameAt(field.Position) {
+				return &schemaMember{typeName: def.Name, name: field.Name, declaration: t.nameLocation(i)}
+			}
+			for _, arg := range field.Arguments {
+				if nameAt(arg.Position) {
+					return &schemaMember{typeName: def.Name, name: field.Name, argument: arg.Name, declaration: t.nameLocation(i)}
+				}
+			}
+		}
+		for _, value := range def.EnumValues {
+			if nameAt(value.Position) {
+				return &schemaMember{typeName: def.Name, name: value.Name, declaration: t.nameLocation(i)}
+			}
+		}
+	}
+	return nil
+}
+
+// matches reports whether name in an operation document refers to m.
+func (m *schemaMember) matches(name queryName) bool {
+	if name.parent == nil || name.parent.Name != m.typeName {
+		return false
+	}
+	switch name.kind {
+	case queryNameField, queryNameInputField:
+		return m.argument == "" && name.field != nil && name.field.Name == m.name
+	case queryNameEnumValue:
+		return m.argument == "" && name.enumValue != nil && name.enumValue.Name == m.name
+	case queryNameArgument:
+		return m.argument != "" && name.field != nil && name.field.Name == m.name && name.argument != nil && name.argument.Name == m.argument
+	default:
+		return false
+	}
+}
+
+// findOperationReferences returns the names in the executable documents of p
+// that match, resolved against schema.
+func (s *Server) findOperationReferences(p *project, schema *ast.Schema, match func(queryName) bool) []protocol.Location {
+	locations := make([]protocol.Location, 0)
+	for _, source := range s.collectDocumentSources(p) {
+		doc, err := s.state.index.queryDocument(source)
+		if err != nil {
+			continue
+		}
+		for _, name := range queryNames(doc, schema) {
+			if !match(name) {
+				continue
+			}
+			if loc := locationFromDefinition(name.text, name.pos); loc != nil {
+				locations = append(locations, *loc)
+			}
+		}
+	}
+	return locations
+}
+
 func findSchemaTypeReferencesInSources(sources []*ast.Source, target string, includeDeclaration bool) []protocol.Location {
 	locations := make([]protocol.Location, 0)
 	seen := make(map[string]struct{})
@@ -68,6 +178,10 @@ func findSchemaTypeReferencesInSources(sources []*ast.Source, target string, inc
 	}
 
 	for _, source := range sources {
+		if isIntrospectionURI(protocol.DocumentUri(source.Name)) {
+			// Converted introspection results have no SDL text to point into.
+			continue
+		}
 		doc, err := parser.ParseSchema(source)
 		if err != nil {
 			continue
@@ -1,52 +1,142 @@
 package ls
 
 import (
+	"errors"
+	"fmt"
 	"log/slog"
+	"slices"
+	"sort"
+	"strings"
 
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/lexer"
 	"github.com/vektah/gqlparser/v2/parser"
 )
 
+// renameTarget is the name a rename at some position applies to.
+type renameTarget struct {
+	name string
+	// sigil is written before the name, like the `$` of variables; a new
+	// name may include it.
+	sigil string
+	// rng is the range of the name at the position.
+	rng  protocol.Range
+	edit func(newName string) (*protocol.WorkspaceEdit, error)
+}
+
 func (s *Server) rename(_ *glsp.Context, params *protocol.RenameParams) (*protocol.WorkspaceEdit, error) {
 	if params == nil {
 		return nil, nil
 	}
-	uri := params.TextDocument.URI
-
-	s.state.mu.Lock()
-	schema := s.state.schema
-	s.state.mu.Unlock()
-	if schema == nil {
-		slog.Debug("rename: schema not loaded", "uri", uri)
-		return nil, nil
+	target, err := s.renameTargetAt(params.TextDocument.URI, params.Position)
+	if err != nil {
+		return nil, err
 	}
-	if !s.isSchemaURI(uri) {
+	if target == nil {
+		return nil, errors.New("there is nothing to rename at this position")
+	}
+	newName := strings.TrimPrefix(params.NewName, target.sigil)
+	if newName == target.name {
 		return nil, nil
 	}
+	if err := validateNewName(newName); err != nil {
+		return nil, err
+	}
+	return target.edit(newName)
+}
 
+// validateNewName reports why name cannot be given to a schema element or
+// document name.
+func validateNewName(name string) error {
+	if name == "" {
+		return errors.New("the new name is empty")
+	}
+	if !isValidName(name) {
+		return fmt.Errorf("%q is not a valid GraphQL name", name)
+	}
+	if strings.HasPrefix(name, "__") {
+		return fmt.Errorf("%q is reserved: names starting with __ belong to introspection", name)
+	}
+	return nil
+}
+
+func (s *Server) prepareRename(_ *glsp.Context, params *protocol.PrepareRenameParams) (any, error) {
+	target, err := s.renameTargetAt(params.TextDocument.URI, params.Position)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, errors.New("there is nothing to rename at this position")
+	}
+	return protocol.RangeWithPlaceholder{Range: target.rng, Placeholder: target.name}, nil
+}
+
+// renameTargetAt returns what a rename at pos in the document at uri
+// applies to, nil if there is nothing renamable there, or an error saying
+// why the name there cannot be renamed.
+func (s *Server) renameTargetAt(uri protocol.DocumentUri, pos protocol.Position) (*renameTarget, error) {
+	if isIntrospectionURI(uri) {
+		return nil, errors.New("introspection results cannot be renamed")
+	}
 	text, ok := s.documentText(uri)
 	if !ok {
 		return nil, nil
 	}
+	offset, line, column := PositionToRuneOffset(text, pos)
+	if !s.isSchemaURI(uri) {
+		return s.documentRenameTarget(uri, text, offset, line, column)
+	}
 
-	_, line, column := PositionToRuneOffset(text, params.Position)
-	doc, err := parser.ParseSchema(&ast.Source{
+	schema := s.schemaForURI(uri)
+	if schema == nil {
+		slog.Debug("rename: schema not loaded", "uri", uri)
+		return nil, nil
+	}
+	source := &ast.Source{
 		Name:  string(uri),
 		Input: text,
-	})
-	if err == nil && doc != nil {
-		if enumName, enumValue := findSchemaEnumValueAtPosition(doc, text, line, column); enumName != "" {
-			if params.NewName == "" || params.NewName == enumValue {
-				return nil, nil
+	}
+	doc, err := parser.ParseSchema(source)
+	if err != nil {
+		return nil, errors.New("the document has syntax errors")
+	}
+	t := newSymbolTokens(source)
+	i := t.tokenAt(offset)
+	if t.kindAt(i) != lexer.Name {
+		return nil, nil
+	}
+	rng := t.span(i, i)
+	p := s.projectForURI(uri)
+
+	if t.kindAt(i-1) == lexer.At {
+		return s.directiveRenameTarget(p, schema, t.tokens[i].Value, rng)
+	}
+
+	if enumName, enumValue := findSchemaEnumValueAtPosition(doc, text, line, column); enumName != "" {
+		return &renameTarget{name: enumValue, rng: rng, edit: func(newName string) (*protocol.WorkspaceEdit, error) {
+			switch newName {
+			case "true", "false", "null":
+				return nil, fmt.Errorf("%q cannot be used as an enum value", newName)
 			}
-			sources, _ := s.collectSchemaSources()
-			locations := findSchemaEnumValueReferencesInSources(sources, enumName, enumValue, true)
+			if def := schema.Types[enumName]; def != nil && def.EnumValues.ForName(newName) != nil {
+				return nil, fmt.Errorf("enum %s already has a value named %s", enumName, newName)
+			}
+			sources, _ := s.collectProjectSchemaSources(p)
+			locations := findSchemaEnumValueReferencesInSources(sources, schema, enumName, enumValue, true)
+			member := &schemaMember{typeName: enumName, name: enumValue}
+			locations = append(locations, s.findOperationReferences(p, schema, member.matches)...)
 			if len(locations) == 0 {
 				return nil, nil
 			}
-			return workspaceEditFromLocations(locations, params.NewName), nil
+			return workspaceEditFromLocations(locations, newName), nil
+		}}, nil
+	}
+
+	if member := schemaMemberAtOffset(uri, text, offset); member != nil {
+		if def := schema.Types[member.typeName]; def != nil && def.Kind != ast.Enum {
+			return s.schemaMemberRenameTarget(p, schema, member, rng), nil
 		}
 	}
 
@@ -58,24 +148,273 @@ func (s *Server) rename(_ *glsp.Context, params *protocol.RenameParams) (*protoc
 		slog.Debug("rename: target not found", "uri", uri, "line", line, "column", column)
 		return nil, nil
 	}
-	if params.NewName == "" || params.NewName == target {
+	if isBuiltInScalar(target) {
+		return nil, fmt.Errorf("built-in scalar %s cannot be renamed", target)
+	}
+	def := schema.Types[target]
+	if def == nil {
+		slog.Debug("rename: type not found", "uri", uri, "target", target)
 		return nil, nil
 	}
-	if isBuiltInScalar(target) {
-		slog.Debug("rename: builtin scalar skipped", "uri", uri, "target", target)
+	if def.BuiltIn || strings.HasPrefix(target, "__") {
+		return nil, fmt.Errorf("introspection type %s cannot be renamed", target)
+	}
+	return &renameTarget{name: target, rng: rng, edit: func(newName string) (*protocol.WorkspaceEdit, error) {
+		if schema.Types[newName] != nil {
+			return nil, fmt.Errorf("type %s already exists", newName)
+		}
+		sources, _ := s.collectProjectSchemaSources(p)
+		locations := findSchemaTypeReferencesInSources(sources, target, true)
+		if len(locations) == 0 {
+			return nil, nil
+		}
+		return workspaceEditFromLocations(locations, newName), nil
+	}}, nil
+}
+
+// schemaMemberRenameTarget renames member, whose name at the position
+// spans rng.
+func (s *Server) schemaMemberRenameTarget(p *project, schema *ast.Schema, member *schemaMember, rng protocol.Range) *renameTarget {
+	name := member.name
+	if member.argument != "" {
+		name = member.argument
+	}
+	return &renameTarget{name: name, rng: rng, edit: func(newName string) (*protocol.WorkspaceEdit, error) {
+		return s.renameSchemaMember(p, schema, member, newName)
+	}}
+}
+
+// directiveRenameTarget renames the directive name, whose definition or
+// usage at the position spans rng, along with its definition and every
+// usage in SDL and operations.
+func (s *Server) directiveRenameTarget(p *project, schema *ast.Schema, name string, rng protocol.Range) (*renameTarget, error) {
+	def := schema.Directives[name]
+	if def == nil {
+		slog.Debug("rename: directive not found", "directive", name)
 		return nil, nil
 	}
-	if schema.Types[target] == nil {
-		slog.Debug("rename: type not found", "uri", uri, "target", target)
+	if isBuiltInPosition(def.Position) {
+		return nil, fmt.Errorf("built-in directive @%s cannot be renamed", name)
+	}
+	return &renameTarget{name: name, sigil: "@", rng: rng, edit: func(newName string) (*protocol.WorkspaceEdit, error) {
+		if schema.Directives[newName] != nil {
+			return nil, fmt.Errorf("directive @%s already exists", newName)
+		}
+		sources, _ := s.collectProjectSchemaSources(p)
+		locations := findDirectiveReferencesInSources(sources, name)
+		locations = append(locations, s.findOperationReferences(p, schema, func(n queryName) bool {
+			return n.kind == queryNameDirective && n.text == name
+		})...)
+		if len(locations) == 0 {
+			return nil, nil
+		}
+		return workspaceEditFromLocations(locations, newName), nil
+	}}, nil
+}
+
+// schemaMemberForName returns the schema field, input field, or field
+// argument that name in an operation document refers to.
+func schemaMemberForName(name queryName) *schemaMember {
+	if name.parent == nil || name.field == nil {
+		return nil
+	}
+	switch name.kind {
+	case queryNameField, queryNameInputField:
+		return &schemaMember{typeName: name.parent.Name, name: name.field.Name}
+	case queryNameArgument:
+		if name.argument != nil {
+			return &schemaMember{typeName: name.parent.Name, name: name.field.Name, argument: name.argument.Name}
+		}
+	}
+	return nil
+}
+
+// renameSchemaMember renames a field or field argument in SDL and in the
+// operations of p, together with its counterparts on related interfaces
+// and implementations.
+func (s *Server) renameSchemaMember(p *project, schema *ast.Schema, member *schemaMember, newName string) (*protocol.WorkspaceEdit, error) {
+	current := member.name
+	if member.argument != "" {
+		current = member.argument
+	}
+	if newName == current {
 		return nil, nil
 	}
+	family := fieldFamily(schema, member.typeName, member.name)
+	if len(family) == 0 {
+		slog.Debug("rename: field not found", "type", member.typeName, "field", member.name)
+		return nil, nil
+	}
+	typeNames := make([]string, 0, len(family))
+	for name := range family {
+		typeNames = append(typeNames, name)
+	}
+	sort.Strings(typeNames)
+	for _, name := range typeNames {
+		def := schema.Types[name]
+		if member.argument == "" {
+			if def.Fields.ForName(newName) != nil {
+				return nil, fmt.Errorf("%s already has a field named %q", name, newName)
+			}
+			continue
+		}
+		if def.Fields.ForName(member.name).Arguments.ForName(newName) != nil {
+			return nil, fmt.Errorf("%s.%s already has an argument named %q", name, member.name, newName)
+		}
+	}
 
-	sources, _ := s.collectSchemaSources()
-	locations := findSchemaTypeReferencesInSources(sources, target, true)
+	sources, _ := s.collectProjectSchemaSources(p)
+	locations := findSchemaMemberDeclarationsInSources(sources, family, member)
+	locations = append(locations, s.findOperationReferences(p, schema, func(name queryName) bool {
+		if name.parent == nil {
+			return false
+		}
+		if _, ok := family[name.parent.Name]; !ok {
+			return false
+		}
+		counterpart := *member
+		counterpart.typeName = name.parent.Name
+		return counterpart.matches(name)
+	})...)
 	if len(locations) == 0 {
 		return nil, nil
 	}
-	return workspaceEditFromLocations(locations, params.NewName), nil
+	return workspaceEditFromLocations(locations, newName), nil
+}
+
+// fieldFamily returns the types that declare fieldName together with
+// typeName: the interfaces it implements that declare the field, the types
+// implementing those, and so on.
+func fieldFamily(schema *ast.Schema, typeName, fieldName string) map[string]struct{} {
+	family := make(map[string]struct{})
+	if def := schema.Types[typeName]; def == nil || def.BuiltIn {
+		return family
+	}
+	queue := []string{typeName}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if _, ok := family[name]; ok {
+			continue
+		}
+		def := schema.Types[name]
+		if def == nil || def.Fields.ForName(fieldName) == nil {
+			continue
+		}
+		family[name] = struct{}{}
+		queue = append(queue, def.Interfaces...)
+		for _, other := range schema.Types {
+			if slices.Contains(other.Interfaces, name) {
+				queue = append(queue, other.Name)
+			}
+		}
+	}
+	return family
+}
+
+// findSchemaMemberDeclarationsInSources returns the names of the fields, or
+// field arguments, declared as member on the types of family.
+func findSchemaMemberDeclarationsInSources(sources []*ast.Source, family map[string]struct{}, member *schemaMember) []protocol.Location {
+	locations := make([]protocol.Location, 0)
+	for _, source := range sources {
+		if isIntrospectionURI(protocol.DocumentUri(source.Name)) {
+			continue
+		}
+		doc, err := parser.ParseSchema(source)
+		if err != nil {
+			continue
+		}
+		t := newSymbolTokens(source)
+		addName := func(pos *ast.Position) {
+			if i := t.skipDescription(t.index(pos)); t.kindAt(i) == lexer.Name {
+				locations = append(locations, *t.nameLocation(i))
+			}
+		}
+		defs := append(ast.DefinitionList{}, doc.Definitions...)
+		defs = append(defs, doc.Extensions...)
+		for _, def := range defs {
+			if _, ok := family[def.Name]; !ok {
+				continue
+			}
+			field := def.Fields.ForName(member.name)
+			if field == nil {
+				continue
+			}
+			if member.argument == "" {
+				addName(field.Position)
+			} else if arg := field.Arguments.ForName(member.argument); arg != nil {
+				addName(arg.Position)
+			}
+		}
+	}
+	return locations
+}
+
+// findDirectiveReferencesInSources returns the names of the definition of
+// the directive name and of its usages in SDL.
+func findDirectiveReferencesInSources(sources []*ast.Source, name string) []protocol.Location {
+	locations := make([]protocol.Location, 0)
+	for _, source := range sources {
+		if isIntrospectionURI(protocol.DocumentUri(source.Name)) {
+			continue
+		}
+		doc, err := parser.ParseSchema(source)
+		if err != nil {
+			continue
+		}
+		t := newSymbolTokens(source)
+		addName := func(pos *ast.Position) {
+			if i := t.index(pos); t.kindAt(i) == lexer.Name {
+				locations = append(locations, *t.nameLocation(i))
+			}
+		}
+		addUsages := func(directives ast.DirectiveList) {
+			for _, directive := range directives {
+				if directive.Name == name {
+					addName(directive.Position)
+				}
+			}
+		}
+		addArgumentUsages := func(args ast.ArgumentDefinitionList) {
+			for _, arg := range args {
+				addUsages(arg.Directives)
+			}
+		}
+
+		schemaDefs := append(ast.SchemaDefinitionList{}, doc.Schema...)
+		schemaDefs = append(schemaDefs, doc.SchemaExtension...)
+		for _, schemaDef := range schemaDefs {
+			addUsages(schemaDef.Directives)
+		}
+		for _, directive := range doc.Directives {
+			if directive.Name == name {
+				addName(directive.Position)
+			}
+			addArgumentUsages(directive.Arguments)
+		}
+		defs := append(ast.DefinitionList{}, doc.Definitions...)
+		defs = append(defs, doc.Extensions...)
+		for _, def := range defs {
+			addUsages(def.Directives)
+			for _, field := range def.Fields {
+				addUsages(field.Directives)
+				addArgumentUsages(field.Arguments)
+			}
+			for _, value := range def.EnumValues {
+				addUsages(value.Directives)
+			}
+		}
+	}
+	return locations
+}
+
+func isValidName(name string) bool {
+	for i, r := range name {
+		if !isNameContinue(r) || i == 0 && !isNameStart(r) {
+			return false
+		}
+	}
+	return name != ""
 }
 
 func workspaceEditFromLocations(locations []protocol.Location, newName string) *protocol.WorkspaceEdit {
@@ -160,7 +499,11 @@ func valueMatchesEnumAtPosition(value *ast.Value, enumName, text string, line, c
 	return matchesTypeName(text, line, column, value.Raw, value.Position.Column)
 }
 
-func findSchemaEnumValueReferencesInSources(sources []*ast.Source, enumName, valueName string, includeDeclaration bool) []protocol.Location {
+// findSchemaEnumValueReferencesInSources returns where the value valueName
+// of enumName is written in SDL: its declaration when includeDeclaration is
+// set, and the default values of arguments and input fields, including
+// values nested in list and input object defaults.
+func findSchemaEnumValueReferencesInSources(sources []*ast.Source, schema *ast.Schema, enumName, valueName string, includeDeclaration bool) []protocol.Location {
 	locations := make([]protocol.Location, 0)
 	seen := make(map[string]struct{})
 
@@ -175,8 +518,42 @@ func findSchemaEnumValueReferencesInSources(sources []*ast.Source, enumName, val
 		seen[key] = struct{}{}
 		locations = append(locations, *loc)
 	}
+	// addDefault adds the enum values in value, a default of type t.
+	var addDefault func(value *ast.Value, t *ast.Type)
+	addDefault = func(value *ast.Value, t *ast.Type) {
+		if value == nil || t == nil {
+			return
+		}
+		switch value.Kind {
+		case ast.EnumValue:
+			if t.Name() == enumName && value.Raw == valueName {
+				addLocation(locationFromDefinition(valueName, value.Position))
+			}
+		case ast.ListValue:
+			elem := t
+			if t.Elem != nil {
+				elem = t.Elem
+			}
+			for _, child := range value.Children {
+				addDefault(child.Value, elem)
+			}
+		case ast.ObjectValue:
+			def := schema.Types[t.Name()]
+			if def == nil {
+				return
+			}
+			for _, child := range value.Children {
+				if field := def.Fields.ForName(child.Name); field != nil {
+					addDefault(child.Value, field.Type)
+				}
+			}
+		}
+	}
 
 	for _, source := range sources {
+		if isIntrospectionURI(protocol.DocumentUri(source.Name)) {
+			continue
+		}
 		doc, err := parser.ParseSchema(source)
 		if err != nil {
 			continue
@@ -200,38 +577,19 @@ func findSchemaEnumValueReferencesInSources(sources []*ast.Source, enumName, val
 				if field == nil {
 					continue
 				}
-				if field.Type != nil && field.Type.Name() == enumName {
-					if matchesEnumValue(field.DefaultValue, valueName) {
-						addLocation(locationFromDefinition(valueName, field.DefaultValue.Position))
-					}
-				}
+				addDefault(field.DefaultValue, field.Type)
 				for _, arg := range field.Arguments {
-					if arg.Type != nil && arg.Type.Name() == enumName {
-						if matchesEnumValue(arg.DefaultValue, valueName) {
-							addLocation(locationFromDefinition(valueName, arg.DefaultValue.Position))
-						}
-					}
+					addDefault(arg.DefaultValue, arg.Type)
 				}
 			}
 		}
 
 		for _, directive := range doc.Directives {
 			for _, arg := range directive.Arguments {
-				if arg.Type != nil && arg.Type.Name() == enumName {
-					if matchesEnumValue(arg.DefaultValue, valueName) {
-						addLocation(locationFromDefinition(valueName, arg.DefaultValue.Position))
-					}
-				}
+				addDefault(arg.DefaultValue, arg.Type)
 			}
 		}
 	}
 
 	return locations
 }
-
-func matchesEnumValue(value *ast.Value, name string) bool {
-	if value == nil || value.Kind != ast.EnumValue || value.Position == nil {
-		return false
-	}
-	return value.Raw == name
-}
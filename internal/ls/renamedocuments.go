@@ -0,0 +1,169 @@
+package ls
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// documentRenameTarget returns the rename target at the rune offset of an
+// executable document: a fragment, operation, or variable name, or the
+// schema field, argument, or directive used there.
+func (s *Server) documentRenameTarget(uri protocol.DocumentUri, text string, offset, line, column int) (*renameTarget, error) {
+	doc, err := parser.ParseQuery(&ast.Source{
+		Name:  string(uri),
+		Input: text,
+	})
+	if err != nil {
+		return nil, errors.New("the document has syntax errors")
+	}
+	p := s.projectForURI(uri)
+
+	for _, fragment := range doc.Fragments {
+		if pos := namePositionAfterKeyword(fragment.Position, "fragment"); positionContainsOffset(pos, offset) {
+			return s.fragmentRenameTarget(p, uri, doc, fragment.Name, pos), nil
+		}
+	}
+	if spread := findFragmentSpreadAtPosition(doc, offset, line, column); spread != nil {
+		return s.fragmentRenameTarget(p, uri, doc, spread.Name, spread.Position), nil
+	}
+	for _, op := range doc.Operations {
+		if op.Name == "" {
+			continue
+		}
+		if pos := namePositionAfterKeyword(op.Position, string(op.Operation)); positionContainsOffset(pos, offset) {
+			return operationRenameTarget(doc, op, pos), nil
+		}
+	}
+
+	schema := s.schemaForURI(uri)
+	if schema == nil {
+		schema = &ast.Schema{}
+	}
+	for _, op := range doc.Operations {
+		for _, def := range op.VariableDefinitions {
+			if nameCovers(def.Position, "$"+def.Variable, offset) {
+				return variableRenameTarget(op, def.Variable, def.Position), nil
+			}
+		}
+		for _, name := range queryNames(&ast.QueryDocument{Operations: ast.OperationList{op}}, schema) {
+			if name.kind == queryNameVariable && name.covers(offset) {
+				return variableRenameTarget(op, strings.TrimPrefix(name.text, "$"), name.pos), nil
+			}
+		}
+	}
+	for _, name := range queryNames(doc, schema) {
+		if !name.covers(offset) {
+			continue
+		}
+		if name.kind == queryNameVariable {
+			// Operations are handled above, so this is a fragment.
+			return nil, errors.New("variables used in fragments can only be renamed from their operation")
+		}
+		if name.kind == queryNameDirective {
+			return s.directiveRenameTarget(p, schema, name.text, locationFromDefinition(name.text, name.pos).Range)
+		}
+		if member := schemaMemberForName(name); member != nil {
+			return s.schemaMemberRenameTarget(p, schema, member, locationFromDefinition(name.text, name.pos).Range), nil
+		}
+		break
+	}
+	return nil, nil
+}
+
+// fragmentRenameTarget renames the fragment name, declared or spread at
+// pos, along with every spread of it in the documents of p.
+func (s *Server) fragmentRenameTarget(p *project, uri protocol.DocumentUri, doc *ast.QueryDocument, name string, pos *ast.Position) *renameTarget {
+	return &renameTarget{name: name, rng: locationFromDefinition(name, pos).Range, edit: func(newName string) (*protocol.WorkspaceEdit, error) {
+		if newName == "on" {
+			return nil, errors.New(`"on" cannot be used as a fragment name`)
+		}
+		if _, ok := s.workspaceFragments(uri, doc)[newName]; ok {
+			return nil, fmt.Errorf("fragment %s already exists", newName)
+		}
+
+		sources := s.collectDocumentSources(p)
+		current := false
+		for _, source := range sources {
+			current = current || protocol.DocumentUri(source.Name) == uri
+		}
+		if !current {
+			text, _ := s.documentText(uri)
+			sources = append(sources, &ast.Source{Name: string(uri), Input: text})
+		}
+
+		locations := make([]protocol.Location, 0)
+		add := func(pos *ast.Position) {
+			if loc := locationFromDefinition(name, pos); loc != nil {
+				locations = append(locations, *loc)
+			}
+		}
+		for _, source := range sources {
+			doc, err := s.state.index.queryDocument(source)
+			if err != nil {
+				continue
+			}
+			for _, op := range doc.Operations {
+				for _, spread := range fragmentSpreads(op.SelectionSet) {
+					if spread.Name == name {
+						add(spread.Position)
+					}
+				}
+			}
+			for _, fragment := range doc.Fragments {
+				if fragment.Name == name {
+					add(namePositionAfterKeyword(fragment.Position, "fragment"))
+				}
+				for _, spread := range fragmentSpreads(fragment.SelectionSet) {
+					if spread.Name == name {
+						add(spread.Position)
+					}
+				}
+			}
+		}
+		return workspaceEditFromLocations(locations, newName), nil
+	}}
+}
+
+// operationRenameTarget renames op, whose name is at pos.
+func operationRenameTarget(doc *ast.QueryDocument, op *ast.OperationDefinition, pos *ast.Position) *renameTarget {
+	loc := locationFromDefinition(op.Name, pos)
+	return &renameTarget{name: op.Name, rng: loc.Range, edit: func(newName string) (*protocol.WorkspaceEdit, error) {
+		if doc.Operations.ForName(newName) != nil {
+			return nil, fmt.Errorf("operation %s already exists in this document", newName)
+		}
+		return workspaceEditFromLocations([]protocol.Location{*loc}, newName), nil
+	}}
+}
+
+// variableRenameTarget renames the variable name of op, whose `$` at pos
+// the position is on, along with its declaration and usages in op.
+func variableRenameTarget(op *ast.OperationDefinition, name string, pos *ast.Position) *renameTarget {
+	return &renameTarget{name: name, sigil: "$", rng: locationFromDefinition(name, namePositionAfterKeyword(pos, "$")).Range, edit: func(newName string) (*protocol.WorkspaceEdit, error) {
+		if op.VariableDefinitions.ForName(newName) != nil {
+			return nil, fmt.Errorf("variable $%s is already declared", newName)
+		}
+
+		locations := make([]protocol.Location, 0)
+		add := func(pos *ast.Position) {
+			if loc := locationFromDefinition(name, namePositionAfterKeyword(pos, "$")); loc != nil {
+				locations = append(locations, *loc)
+			}
+		}
+		for _, def := range op.VariableDefinitions {
+			if def.Variable == name {
+				add(def.Position)
+			}
+		}
+		for _, n := range queryNames(&ast.QueryDocument{Operations: ast.OperationList{op}}, &ast.Schema{}) {
+			if n.kind == queryNameVariable && n.text == "$"+name {
+				add(n.pos)
+			}
+		}
+		return workspaceEditFromLocations(locations, newName), nil
+	}}
+}
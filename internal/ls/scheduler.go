@@ -0,0 +1,89 @@
+package ls
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// diagnosticsDelay is how long a document must stay unchanged before its
+// diagnostics are recomputed.
+const diagnosticsDelay = 150 * time.Millisecond
+
+// diagnosticsScheduler debounces diagnostics runs per URI. A newer change to
+// a URI cancels its pending run, or the context of its running one, and runs
+// are serialized so schema reloads never overlap.
+type diagnosticsScheduler struct {
+	delay   time.Duration
+	mu      sync.Mutex
+	runMu   sync.Mutex
+	pending map[protocol.DocumentUri]*diagnosticsRun
+	wg      sync.WaitGroup
+}
+
+type diagnosticsRun struct {
+	timer  *time.Timer
+	cancel context.CancelFunc
+}
+
+func newDiagnosticsScheduler(delay time.Duration) *diagnosticsScheduler {
+	return &diagnosticsScheduler{
+		delay:   delay,
+		pending: make(map[protocol.DocumentUri]*diagnosticsRun),
+	}
+}
+
+// schedule runs fn for uri once no newer schedule for uri arrived within the
+// delay. fn should stop early once its context is cancelled.
+func (d *diagnosticsScheduler) schedule(uri protocol.DocumentUri, fn func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &diagnosticsRun{cancel: cancel}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopLocked(uri)
+	d.wg.Add(1)
+	run.timer = time.AfterFunc(d.delay, func() {
+		defer d.wg.Done()
+		defer cancel()
+		d.runMu.Lock()
+		defer d.runMu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		fn(ctx)
+		d.mu.Lock()
+		if d.pending[uri] == run {
+			delete(d.pending, uri)
+		}
+		d.mu.Unlock()
+	})
+	d.pending[uri] = run
+}
+
+// cancel drops the pending or running run of uri.
+func (d *diagnosticsScheduler) cancel(uri protocol.DocumentUri) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stopLocked(uri)
+}
+
+func (d *diagnosticsScheduler) stopLocked(uri protocol.DocumentUri) {
+	run := d.pending[uri]
+	if run == nil {
+		return
+	}
+	if run.timer.Stop() {
+		// The timer never fired, so its function will not call Done.
+		d.wg.Done()
+	}
+	run.cancel()
+	delete(d.pending, uri)
+}
+
+// wait blocks until every scheduled run has finished or been cancelled.
+func (d *diagnosticsScheduler) wait() {
+	d.wg.Wait()
+}
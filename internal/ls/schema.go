@@ -10,9 +10,8 @@ import (
 
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
-	"github.com/vektah/gqlparser/v2"
 	"github.com/vektah/gqlparser/v2/ast"
-	"github.com/vektah/gqlparser/v2/parser"
+	"github.com/vektah/gqlparser/v2/validator"
 )
 
 const (
@@ -32,128 +31,206 @@ func newScanStats() *scanStats {
 }
 
 func (s *Server) publishQueryDiagnostics(ctx *glsp.Context, uri protocol.DocumentUri, text string) {
-	if s.isSchemaURI(uri) {
+	if s.isSchemaURI(uri) || isIntrospectionURI(uri) {
 		s.state.mu.Lock()
 		delete(s.state.queryDiagnostics, uri)
+		delete(s.state.queryVersions, uri)
 		s.state.mu.Unlock()
 		s.publishCombinedDiagnostics(ctx, uri)
 		return
 	}
 
-	doc := &ast.Source{
-		Name:  string(uri),
-		Input: text,
+	s.updateQueryDiagnostics(uri, text)
+	s.publishCombinedDiagnostics(ctx, uri)
+}
+
+func (s *Server) loadWorkspaceSchema(ctx *glsp.Context) {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+	s.rememberClient(ctx)
+	slog.Debug("loading workspace schema")
+	diagnosticsByURI := make(map[protocol.DocumentUri][]protocol.Diagnostic)
+	for _, p := range s.allProjects() {
+		for uri, list := range s.loadProjectSchema(p) {
+			diagnosticsByURI[uri] = append(diagnosticsByURI[uri], list...)
+		}
 	}
 
-	_, err := parser.ParseQuery(doc)
-	diagnostics := GqlErrorDiagnostics(err)
 	s.state.mu.Lock()
-	s.state.queryDiagnostics[uri] = diagnostics
+	s.state.schemaDiagnostics = diagnosticsByURI
+	for uri := range diagnosticsByURI {
+		delete(s.state.queryDiagnostics, uri)
+	}
 	s.state.mu.Unlock()
-	slog.Debug("query diagnostics updated", "uri", uri, "count", len(diagnostics))
-	s.publishCombinedDiagnostics(ctx, uri)
+	if len(diagnosticsByURI) > 0 {
+		slogSchemaDiagnostics(diagnosticsByURI)
+	}
+
+	s.refreshOpenQueryDiagnostics()
+	s.publishAllDiagnostics(ctx)
 }
 
-func (s *Server) loadWorkspaceSchema(ctx *glsp.Context) {
-	slog.Debug("loading workspace schema")
+// rememberClient keeps ctx for the reloads that background endpoint fetches
+// trigger.
+func (s *Server) rememberClient(ctx *glsp.Context) {
+	if ctx == nil {
+		return
+	}
 	s.state.mu.Lock()
-	previousSchema := s.state.schema
+	s.state.clientCtx = ctx
 	s.state.mu.Unlock()
+}
 
-	sources, uris := s.collectSchemaSources()
+// reloadProjectSchemas reloads only the given projects, replacing their
+// schema diagnostics and clearing those of sources they no longer load.
+func (s *Server) reloadProjectSchemas(ctx *glsp.Context, projects []*project) {
+	s.loadMu.Lock()
+	defer s.loadMu.Unlock()
+	s.rememberClient(ctx)
+	slog.Debug("reloading project schemas", "projects", len(projects))
+	previous := make(map[protocol.DocumentUri]struct{})
 	diagnosticsByURI := make(map[protocol.DocumentUri][]protocol.Diagnostic)
-	var schema *ast.Schema
-	if len(sources) > 0 {
-		if _, err := parser.ParseSchemas(sources...); err != nil {
-			slog.Debug("schema parse error; skipping validation", "error", err)
-			diagnosticsByURI = GqlErrorDiagnosticsByFile(err, uris)
-			ensureSchemaDiagnosticEntries(diagnosticsByURI, uris)
-			s.state.mu.Lock()
-			s.state.schemaDiagnostics = diagnosticsByURI
-			s.state.mu.Unlock()
-			s.publishAllDiagnostics(ctx)
-			return
+	for _, p := range projects {
+		s.state.mu.Lock()
+		for uri := range p.schemaURIs {
+			previous[uri] = struct{}{}
 		}
-		loadedSchema, err := gqlparser.LoadSchema(sources...)
-		schema = loadedSchema
-		if err != nil {
-			diagnosticsByURI = GqlErrorDiagnosticsByFile(err, uris)
-			if previousSchema != nil {
-				slog.Debug("schema validation error; keeping previous schema", "error", err)
-				schema = previousSchema
-			}
+		s.state.mu.Unlock()
+		for uri, list := range s.loadProjectSchema(p) {
+			diagnosticsByURI[uri] = append(diagnosticsByURI[uri], list...)
 		}
 	}
 
-	ensureSchemaDiagnosticEntries(diagnosticsByURI, uris)
 	s.state.mu.Lock()
-	s.state.schema = schema
-	s.state.schemaDiagnostics = diagnosticsByURI
-	s.state.schemaURIs = uris
-	for uri := range uris {
+	for uri := range previous {
+		if _, ok := diagnosticsByURI[uri]; !ok {
+			// Publish an empty list once so the client drops them.
+			s.state.schemaDiagnostics[uri] = nil
+		}
+	}
+	for uri, list := range diagnosticsByURI {
+		s.state.schemaDiagnostics[uri] = list
 		delete(s.state.queryDiagnostics, uri)
 	}
 	s.state.mu.Unlock()
-	slog.Debug("schema load complete", "sources", len(sources), "diagnostics", len(diagnosticsByURI))
 	if len(diagnosticsByURI) > 0 {
 		slogSchemaDiagnostics(diagnosticsByURI)
 	}
 
+	s.refreshOpenQueryDiagnostics()
 	s.publishAllDiagnostics(ctx)
 }
 
-func (s *Server) collectSchemaSources() ([]*ast.Source, map[protocol.DocumentUri]struct{}) {
-	root := ""
-	var schemaPaths []string
+// loadProjectSchema reloads the schema and document index of p and returns
+// its schema diagnostics, with an entry for every source so fixed files get
+// cleared. The schema is only rebuilt when its sources changed, and then only
+// the changed sources are reparsed.
+func (s *Server) loadProjectSchema(p *project) map[protocol.DocumentUri][]protocol.Diagnostic {
+	s.indexProjectDocuments(p)
+	sources, uris := s.collectProjectSchemaSources(p)
+	key := s.state.index.schemaKey(sources)
+
 	s.state.mu.Lock()
-	root = s.state.rootPath
-	schemaPaths = append(schemaPaths, s.state.schemaPaths...)
+	previousSchema := p.schema
+	if p.schemaBuilt && p.schemaKey == key {
+		diagnosticsByURI := copyDiagnostics(p.schemaDiagnostics)
+		s.state.mu.Unlock()
+		slog.Debug("schema sources unchanged", "project", p.name, "sources", len(sources))
+		return diagnosticsByURI
+	}
 	s.state.mu.Unlock()
 
-	if len(schemaPaths) > 0 {
-		return collectSchemaSourcesFromPaths(s.state, root, schemaPaths)
+	diagnosticsByURI, schema, parsed := s.buildProjectSchema(p, sources, uris, previousSchema)
+	ensureSchemaDiagnosticEntries(diagnosticsByURI, uris)
+	s.state.mu.Lock()
+	if parsed {
+		p.schema = schema
+		p.schemaURIs = uris
 	}
+	p.schemaBuilt = true
+	p.schemaKey = key
+	p.schemaDiagnostics = copyDiagnostics(diagnosticsByURI)
+	s.state.mu.Unlock()
+	slog.Debug("schema load complete", "project", p.name, "sources", len(sources), "diagnostics", len(diagnosticsByURI))
+	return diagnosticsByURI
+}
 
-	if root == "" {
-		return nil, map[protocol.DocumentUri]struct{}{}
+// buildProjectSchema validates the cached parse results of sources into a
+// schema. parsed is false when a source has syntax errors, in which case
+// validation is skipped and the project keeps its current schema.
+func (s *Server) buildProjectSchema(p *project, sources []*ast.Source, uris map[protocol.DocumentUri]struct{}, previousSchema *ast.Schema) (map[protocol.DocumentUri][]protocol.Diagnostic, *ast.Schema, bool) {
+	diagnosticsByURI := make(map[protocol.DocumentUri][]protocol.Diagnostic)
+	if len(sources) == 0 {
+		return diagnosticsByURI, nil, true
 	}
 
-	uris := make(map[protocol.DocumentUri]struct{})
-	var sources []*ast.Source
-	stats := newScanStats()
-	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+	docs := []*ast.SchemaDocument{preludeDocument()}
+	for _, source := range sources {
+		doc, err := s.state.index.schemaDocument(source)
 		if err != nil {
-			return nil
-		}
-		if entry.IsDir() {
-			name := entry.Name()
-			if shouldSkipDir(name) {
-				return filepath.SkipDir
+			slog.Debug("schema parse error; skipping validation", "project", p.name, "error", err)
+			for uri, list := range GqlErrorDiagnosticsByFile(err, uris) {
+				diagnosticsByURI[uri] = append(diagnosticsByURI[uri], list...)
 			}
-			if root != "" && exceedsMaxDepth(root, path) {
-				return filepath.SkipDir
-			}
-			if tooLargeDir(path) {
-				slog.Debug("schema scan: skipping large directory", "path", path)
-				return filepath.SkipDir
-			}
-			return nil
-		}
-		if !isGraphQLFile(path) {
-			return nil
+			continue
 		}
+		docs = append(docs, doc)
+	}
+	if len(diagnosticsByURI) > 0 {
+		return diagnosticsByURI, nil, false
+	}
 
-		addSchemaSource(s.state, path, uris, &sources)
-		stats.fileCount++
-		if stats.fileCount >= maxSchemaFiles {
-			return errStopScan
+	schema, err := validator.ValidateSchemaDocument(mergeSchemaDocuments(docs...))
+	remapIntrospectionPositions(schema, s.introspectionDocuments(uris))
+	if err != nil {
+		diagnosticsByURI = GqlErrorDiagnosticsByFile(err, uris)
+		if previousSchema != nil {
+			slog.Debug("schema validation error; keeping previous schema", "project", p.name, "error", err)
+			schema = previousSchema
 		}
-		return nil
-	})
-	if errors.Is(err, errStopScan) {
-		slog.Debug("schema scan stopped", "files", stats.fileCount)
+	}
+	return diagnosticsByURI, schema, true
+}
+
+func copyDiagnostics(diagnosticsByURI map[protocol.DocumentUri][]protocol.Diagnostic) map[protocol.DocumentUri][]protocol.Diagnostic {
+	copied := make(map[protocol.DocumentUri][]protocol.Diagnostic, len(diagnosticsByURI))
+	for uri, list := range diagnosticsByURI {
+		copied[uri] = list
+	}
+	return copied
+}
+
+// collectSchemaSources returns the schema sources of the default project.
+func (s *Server) collectSchemaSources() ([]*ast.Source, map[protocol.DocumentUri]struct{}) {
+	return s.collectProjectSchemaSources(&s.state.project)
+}
+
+func (s *Server) collectProjectSchemaSources(p *project) ([]*ast.Source, map[protocol.DocumentUri]struct{}) {
+	s.state.mu.Lock()
+	root := s.state.rootPath
+	s.state.mu.Unlock()
+
+	if schemaPaths := s.schemaPatterns(p); len(schemaPaths) > 0 {
+		return collectSchemaSourcesFromPaths(s.state, root, s.resolveEndpoints(p, schemaPaths))
+	}
+
+	// Without explicit paths only a lone default project discovers schema
+	// files; scanning for every project would merge unrelated schemas.
+	if root == "" || p.name != "" || s.hasNamedProjects() {
+		return nil, map[protocol.DocumentUri]struct{}{}
 	}
 
+	uris := make(map[protocol.DocumentUri]struct{})
+	var sources []*ast.Source
+	walkGraphQLFiles(s.state, root, newScanStats(), func(path string) {
+		s.state.mu.Lock()
+		included := p.includesPath(root, path)
+		s.state.mu.Unlock()
+		if !included {
+			return
+		}
+		addSchemaSource(s.state, path, uris, &sources)
+	})
 	return sources, uris
 }
 
@@ -164,7 +241,7 @@ func collectSchemaSourcesFromPaths(state *State, root string, schemaPaths []stri
 	stats := newScanStats()
 
 	for _, pattern := range schemaPaths {
-		for _, path := range expandSchemaPattern(root, pattern) {
+		for _, path := range expandPattern(state, root, pattern) {
 			if path == "" {
 				continue
 			}
@@ -181,7 +258,7 @@ func collectSchemaSourcesFromPaths(state *State, root string, schemaPaths []stri
 				sources = append(sources, collectSchemaSourcesFromDir(state, path, uris, stats)...)
 				continue
 			}
-			if !isGraphQLFile(path) {
+			if !isSchemaSourceFile(path) {
 				continue
 			}
 			addSchemaSource(state, path, uris, &sources)
@@ -198,6 +275,42 @@ func collectSchemaSourcesFromPaths(state *State, root string, schemaPaths []stri
 
 func collectSchemaSourcesFromDir(state *State, root string, uris map[protocol.DocumentUri]struct{}, stats *scanStats) []*ast.Source {
 	var sources []*ast.Source
+	walkFiles(state, "schema", root, stats, isSchemaSourceFile, func(path string) {
+		addSchemaSource(state, path, uris, &sources)
+	})
+	return sources
+}
+
+func walkGraphQLFiles(state *State, root string, stats *scanStats, visit func(path string)) {
+	walkFiles(state, "graphql", root, stats, isGraphQLFile, visit)
+}
+
+// walkFiles visits the files under root accepted by match. The listing is
+// cached under kind and root until the scans are invalidated.
+func walkFiles(state *State, kind, root string, stats *scanStats, match func(path string) bool, visit func(path string)) {
+	paths := state.index.scan("walk\x00"+kind+"\x00"+root, func() []string {
+		return listFiles(root, match)
+	})
+	for _, path := range paths {
+		visit(path)
+		stats.fileCount++
+		if stats.fileCount >= maxSchemaFiles {
+			slog.Debug("workspace scan stopped", "root", root, "files", stats.fileCount)
+			return
+		}
+	}
+}
+
+// expandPattern is expandSchemaPattern cached until the scans are
+// invalidated.
+func expandPattern(state *State, root, pattern string) []string {
+	return state.index.scan("pattern\x00"+root+"\x00"+pattern, func() []string {
+		return expandSchemaPattern(root, pattern)
+	})
+}
+
+func listFiles(root string, match func(path string) bool) []string {
+	var paths []string
 	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return nil
@@ -211,25 +324,24 @@ func collectSchemaSourcesFromDir(state *State, root string, uris map[protocol.Do
 				return filepath.SkipDir
 			}
 			if tooLargeDir(path) {
-				slog.Debug("schema scan: skipping large directory", "path", path)
+				slog.Debug("workspace scan: skipping large directory", "path", path)
 				return filepath.SkipDir
 			}
 			return nil
 		}
-		if !isGraphQLFile(path) {
+		if !match(path) {
 			return nil
 		}
-		addSchemaSource(state, path, uris, &sources)
-		stats.fileCount++
-		if stats.fileCount >= maxSchemaFiles {
+		paths = append(paths, path)
+		if len(paths) >= maxSchemaFiles {
 			return errStopScan
 		}
 		return nil
 	})
 	if errors.Is(err, errStopScan) {
-		slog.Debug("schema scan stopped", "files", stats.fileCount)
+		slog.Debug("workspace scan stopped", "root", root, "files", len(paths))
 	}
-	return sources
+	return paths
 }
 
 func addSchemaSource(state *State, path string, uris map[protocol.DocumentUri]struct{}, sources *[]*ast.Source) {
@@ -241,6 +353,19 @@ func addSchemaSource(state *State, path string, uris map[protocol.DocumentUri]st
 	if !ok {
 		return
 	}
+	if isIntrospectionPath(path) {
+		doc, err := state.index.introspectionDocument(uri, content)
+		if err != nil {
+			slog.Debug("introspection result skipped", "uri", uri, "error", err)
+			return
+		}
+		state.mu.Lock()
+		state.introspection[uri] = doc
+		state.mu.Unlock()
+		content = doc.sdl
+	} else if isExecutableDocument(content) {
+		return
+	}
 	uris[uri] = struct{}{}
 	*sources = append(*sources, &ast.Source{
 		Name:  string(uri),
@@ -330,20 +455,35 @@ func (s *Server) publishAllDiagnostics(ctx *glsp.Context) {
 }
 
 func (s *Server) publishCombinedDiagnostics(ctx *glsp.Context, uri protocol.DocumentUri) {
+	schemaDocument := s.isSchemaURI(uri) || isIntrospectionURI(uri)
 	s.state.mu.Lock()
 	queryDiagnostics := s.state.queryDiagnostics[uri]
 	schemaDiagnostics := s.state.schemaDiagnostics[uri]
+	version, open := s.state.versions[uri]
+	computed, hasQuery := s.state.queryVersions[uri]
 	s.state.mu.Unlock()
+	if open && !schemaDocument && (!hasQuery || computed != version) {
+		// The document changed since its diagnostics were computed; the
+		// scheduled run for the new version publishes instead.
+		slog.Debug("stale diagnostics skipped", "uri", uri, "computed", computed, "version", version)
+		return
+	}
 
 	combined := make([]protocol.Diagnostic, 0, len(queryDiagnostics)+len(schemaDiagnostics))
 	combined = append(combined, queryDiagnostics...)
 	combined = append(combined, schemaDiagnostics...)
-	notifyDiagnostics(ctx, uri, combined)
+	var tag *protocol.UInteger
+	if open && version >= 0 {
+		value := protocol.UInteger(version)
+		tag = &value
+	}
+	notifyDiagnostics(ctx, uri, tag, combined)
 }
 
-func notifyDiagnostics(ctx *glsp.Context, uri protocol.DocumentUri, diagnostics []protocol.Diagnostic) {
+func notifyDiagnostics(ctx *glsp.Context, uri protocol.DocumentUri, version *protocol.UInteger, diagnostics []protocol.Diagnostic) {
 	params := protocol.PublishDiagnosticsParams{
 		URI:         uri,
+		Version:     version,
 		Diagnostics: diagnostics,
 	}
 	ctx.Notify(protocol.ServerTextDocumentPublishDiagnostics, params)
@@ -0,0 +1,490 @@
+package ls
+
+import (
+	"sort"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/lexer"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// Semantic token types, in legend order.
+const (
+	semanticType = iota
+	semanticProperty
+	semanticParameter
+	semanticVariable
+	semanticEnumMember
+	semanticDirective
+	semanticFragment
+	semanticOperation
+)
+
+// Semantic token modifiers, as bits in legend order. The type kind modifiers
+// tell named types apart; object types carry none.
+const (
+	semanticDeclaration = 1 << iota
+	semanticDeprecated
+	semanticDefaultLibrary
+	semanticInterface
+	semanticEnum
+	semanticInput
+	semanticScalar
+	semanticUnion
+)
+
+func semanticTokensLegend() protocol.SemanticTokensLegend {
+	return protocol.SemanticTokensLegend{
+		TokenTypes: []string{
+			string(protocol.SemanticTokenTypeType),
+			string(protocol.SemanticTokenTypeProperty),
+			string(protocol.SemanticTokenTypeParameter),
+			string(protocol.SemanticTokenTypeVariable),
+			string(protocol.SemanticTokenTypeEnumMember),
+			"decorator",
+			string(protocol.SemanticTokenTypeClass),
+			string(protocol.SemanticTokenTypeFunction),
+		},
+		TokenModifiers: []string{
+			string(protocol.SemanticTokenModifierDeclaration),
+			string(protocol.SemanticTokenModifierDeprecated),
+			string(protocol.SemanticTokenModifierDefaultLibrary),
+			"interface",
+			"enum",
+			"input",
+			"scalar",
+			"union",
+		},
+	}
+}
+
+func (s *Server) semanticTokensFull(_ *glsp.Context, params *protocol.SemanticTokensParams) (*protocol.SemanticTokens, error) {
+	tokens, ok := s.semanticTokens(params.TextDocument.URI)
+	if !ok {
+		return nil, nil
+	}
+	return &protocol.SemanticTokens{Data: encodeSemanticTokens(tokens, nil)}, nil
+}
+
+func (s *Server) semanticTokensRange(_ *glsp.Context, params *protocol.SemanticTokensRangeParams) (any, error) {
+	tokens, ok := s.semanticTokens(params.TextDocument.URI)
+	if !ok {
+		return nil, nil
+	}
+	return &protocol.SemanticTokens{Data: encodeSemanticTokens(tokens, &params.Range)}, nil
+}
+
+// semanticTokens classifies the names of the document at uri, sorted by
+// position.
+func (s *Server) semanticTokens(uri protocol.DocumentUri) ([]semanticToken, bool) {
+	if isIntrospectionURI(uri) {
+		return nil, false
+	}
+	text, ok := s.documentText(uri)
+	if !ok {
+		return nil, false
+	}
+	source := &ast.Source{
+		Name:  string(uri),
+		Input: text,
+	}
+	h := &highlighter{
+		t:      newSymbolTokens(source),
+		schema: s.schemaForURI(uri),
+	}
+	if s.isSchemaDocument(uri, text) {
+		doc, err := parser.ParseSchema(source)
+		if err != nil {
+			return nil, false
+		}
+		h.schemaDocument(doc)
+	} else {
+		doc, err := parser.ParseQuery(source)
+		if err != nil {
+			return nil, false
+		}
+		h.queryDocument(doc)
+	}
+	sort.SliceStable(h.tokens, func(i, j int) bool {
+		return h.tokens[i].start.Line < h.tokens[j].start.Line ||
+			h.tokens[i].start.Line == h.tokens[j].start.Line && h.tokens[i].start.Character < h.tokens[j].start.Character
+	})
+	return h.tokens, true
+}
+
+type semanticToken struct {
+	start     protocol.Position
+	length    int
+	kind      int
+	modifiers int
+}
+
+// encodeSemanticTokens encodes tokens relative to each other as the protocol
+// expects, keeping those on the lines of within when it is set.
+func encodeSemanticTokens(tokens []semanticToken, within *protocol.Range) []protocol.UInteger {
+	data := make([]protocol.UInteger, 0, 5*len(tokens))
+	var prev protocol.Position
+	for i, tok := range tokens {
+		if i > 0 && tok.start == tokens[i-1].start {
+			continue
+		}
+		if within != nil && (tok.start.Line < within.Start.Line || tok.start.Line > within.End.Line) {
+			continue
+		}
+		deltaStart := tok.start.Character
+		if tok.start.Line == prev.Line {
+			deltaStart -= prev.Character
+		}
+		data = append(data,
+			tok.start.Line-prev.Line,
+			deltaStart,
+			protocol.UInteger(tok.length),
+			protocol.UInteger(tok.kind),
+			protocol.UInteger(tok.modifiers),
+		)
+		prev = tok.start
+	}
+	return data
+}
+
+// highlighter walks a parsed document, classifying the name tokens found
+// at the positions of its nodes. Names the AST keeps without a position
+// (implemented interfaces, union members, type conditions) are found by
+// their place in the token stream.
+type highlighter struct {
+	t      *symbolTokens
+	schema *ast.Schema
+	// local holds the definitions of a schema document, used when no
+	// schema is loaded.
+	local  map[string]*ast.Definition
+	tokens []semanticToken
+}
+
+// add classifies token i. A `@` or `$` right before it is included.
+func (h *highlighter) add(i, kind, modifiers int) {
+	if h.t.kindAt(i) != lexer.Name {
+		return
+	}
+	tok := h.t.tokens[i]
+	start := tok.Pos.Start
+	if prev := h.t.kindAt(i - 1); (prev == lexer.At || prev == lexer.Dollar) && h.t.tokens[i-1].Pos.End == start {
+		start = h.t.tokens[i-1].Pos.Start
+	}
+	h.tokens = append(h.tokens, semanticToken{
+		start:     h.t.position(start),
+		length:    tok.Pos.End - start,
+		kind:      kind,
+		modifiers: modifiers,
+	})
+}
+
+// at returns the index of the n-th token after the one at pos, or -1.
+func (h *highlighter) at(pos *ast.Position, n int) int {
+	i := h.t.index(pos)
+	if i < 0 {
+		return -1
+	}
+	return i + n
+}
+
+func (h *highlighter) definition(name string) *ast.Definition {
+	if h.schema != nil {
+		if def := h.schema.Types[name]; def != nil {
+			return def
+		}
+	}
+	return h.local[name]
+}
+
+func (h *highlighter) typeName(i int, declaration bool) {
+	if h.t.kindAt(i) != lexer.Name {
+		return
+	}
+	name := h.t.tokens[i].Value
+	modifiers := 0
+	if declaration {
+		modifiers |= semanticDeclaration
+	}
+	def := h.definition(name)
+	if (def != nil && def.BuiltIn) || isBuiltInScalar(name) {
+		modifiers |= semanticDefaultLibrary
+	}
+	if def != nil {
+		switch def.Kind {
+		case ast.Interface:
+			modifiers |= semanticInterface
+		case ast.Enum:
+			modifiers |= semanticEnum
+		case ast.InputObject:
+			modifiers |= semanticInput
+		case ast.Scalar:
+			modifiers |= semanticScalar
+		case ast.Union:
+			modifiers |= semanticUnion
+		}
+	} else if isBuiltInScalar(name) {
+		modifiers |= semanticScalar
+	}
+	h.add(i, semanticType, modifiers)
+}
+
+func deprecatedModifier(directives ast.DirectiveList) int {
+	if directives.ForName("deprecated") != nil {
+		return semanticDeprecated
+	}
+	return 0
+}
+
+func (h *highlighter) schemaDocument(doc *ast.SchemaDocument) {
+	h.local = make(map[string]*ast.Definition, len(doc.Definitions))
+	for _, def := range doc.Definitions {
+		h.local[def.Name] = def
+	}
+	for _, def := range doc.Schema {
+		h.schemaDefinition(def)
+	}
+	for _, def := range doc.SchemaExtension {
+		h.schemaDefinition(def)
+	}
+	for _, def := range doc.Definitions {
+		h.typeDefinition(def, true)
+	}
+	for _, def := range doc.Extensions {
+		h.typeDefinition(def, false)
+	}
+	for _, def := range doc.Directives {
+		h.directiveDefinition(def)
+	}
+}
+
+func (h *highlighter) schemaDefinition(def *ast.SchemaDefinition) {
+	h.directives(def.Directives)
+	for _, op := range def.OperationTypes {
+		h.typeName(h.at(op.Position, 2), false)
+	}
+}
+
+func (h *highlighter) typeDefinition(def *ast.Definition, declaration bool) {
+	i := h.t.index(def.Position)
+	if i < 0 {
+		return
+	}
+	h.typeName(i, declaration)
+	i++
+	if h.t.isName(i, "implements") {
+		i = h.typeNames(i+1, lexer.Amp)
+	}
+	h.directives(def.Directives)
+	if len(def.Types) > 0 {
+		for h.t.kindAt(i) == lexer.At {
+			i += 2
+			if h.t.kindAt(i) == lexer.ParenL {
+				i = h.t.closing(i) + 1
+			}
+		}
+		if h.t.kindAt(i) == lexer.Equals {
+			h.typeNames(i+1, lexer.Pipe)
+		}
+	}
+	for _, field := range def.Fields {
+		h.add(h.t.skipDescription(h.t.index(field.Position)), semanticProperty, semanticDeclaration|deprecatedModifier(field.Directives))
+		h.argumentDefinitions(field.Arguments)
+		h.typeRef(field.Type)
+		h.value(field.DefaultValue, field.Type)
+		h.directives(field.Directives)
+	}
+	for _, value := range def.EnumValues {
+		h.add(h.t.skipDescription(h.t.index(value.Position)), semanticEnumMember, semanticDeclaration|deprecatedModifier(value.Directives))
+		h.directives(value.Directives)
+	}
+}
+
+// typeNames classifies a list of type names separated by sep, allowing a
+// leading separator, and returns the index of the token after it.
+func (h *highlighter) typeNames(i int, sep lexer.Type) int {
+	if h.t.kindAt(i) == sep {
+		i++
+	}
+	for h.t.kindAt(i) == lexer.Name {
+		h.typeName(i, false)
+		i++
+		if h.t.kindAt(i) != sep {
+			break
+		}
+		i++
+	}
+	return i
+}
+
+func (h *highlighter) directiveDefinition(def *ast.DirectiveDefinition) {
+	modifiers := semanticDeclaration
+	if isBuiltInDirective(def.Name) {
+		modifiers |= semanticDefaultLibrary
+	}
+	h.add(h.t.index(def.Position), semanticDirective, modifiers)
+	h.argumentDefinitions(def.Arguments)
+}
+
+func (h *highlighter) argumentDefinitions(args ast.ArgumentDefinitionList) {
+	for _, arg := range args {
+		h.add(h.t.skipDescription(h.t.index(arg.Position)), semanticParameter, semanticDeclaration|deprecatedModifier(arg.Directives))
+		h.typeRef(arg.Type)
+		h.value(arg.DefaultValue, arg.Type)
+		h.directives(arg.Directives)
+	}
+}
+
+func (h *highlighter) typeRef(t *ast.Type) {
+	if t == nil {
+		return
+	}
+	if t.Elem != nil {
+		h.typeRef(t.Elem)
+		return
+	}
+	h.typeName(h.t.index(t.Position), false)
+}
+
+func (h *highlighter) directives(directives ast.DirectiveList) {
+	for _, directive := range directives {
+		modifiers := 0
+		if isBuiltInDirective(directive.Name) {
+			modifiers |= semanticDefaultLibrary
+		}
+		h.add(h.t.index(directive.Position), semanticDirective, modifiers)
+		var defs ast.ArgumentDefinitionList
+		if h.schema != nil {
+			if def := h.schema.Directives[directive.Name]; def != nil {
+				defs = def.Arguments
+			}
+		}
+		h.arguments(directive.Arguments, defs)
+	}
+}
+
+func (h *highlighter) arguments(args ast.ArgumentList, defs ast.ArgumentDefinitionList) {
+	for _, arg := range args {
+		def := defs.ForName(arg.Name)
+		modifiers := 0
+		var expected *ast.Type
+		if def != nil {
+			modifiers = deprecatedModifier(def.Directives)
+			expected = def.Type
+		}
+		h.add(h.t.index(arg.Position), semanticParameter, modifiers)
+		h.value(arg.Value, expected)
+	}
+}
+
+// value classifies the variables, enum values, and input object fields of
+// value. expected is the type the value is given for, if known.
+func (h *highlighter) value(value *ast.Value, expected *ast.Type) {
+	if value == nil {
+		return
+	}
+	var def *ast.Definition
+	if expected != nil && expected.Elem == nil {
+		def = h.definition(expected.NamedType)
+	}
+	switch value.Kind {
+	case ast.Variable:
+		h.add(h.at(value.Position, 1), semanticVariable, 0)
+	case ast.EnumValue:
+		modifiers := 0
+		if def != nil {
+			if enumValue := def.EnumValues.ForName(value.Raw); enumValue != nil {
+				modifiers = deprecatedModifier(enumValue.Directives)
+			}
+		}
+		h.add(h.t.index(value.Position), semanticEnumMember, modifiers)
+	case ast.ListValue:
+		var elem *ast.Type
+		if expected != nil {
+			elem = expected.Elem
+		}
+		for _, child := range value.Children {
+			h.value(child.Value, elem)
+		}
+	case ast.ObjectValue:
+		for _, child := range value.Children {
+			modifiers := 0
+			var fieldType *ast.Type
+			if def != nil {
+				if field := def.Fields.ForName(child.Name); field != nil {
+					modifiers = deprecatedModifier(field.Directives)
+					fieldType = field.Type
+				}
+			}
+			h.add(h.t.index(child.Position), semanticProperty, modifiers)
+			h.value(child.Value, fieldType)
+		}
+	}
+}
+
+func (h *highlighter) queryDocument(doc *ast.QueryDocument) {
+	for _, op := range doc.Operations {
+		if op.Name != "" {
+			h.add(h.at(op.Position, 1), semanticOperation, semanticDeclaration)
+		}
+		for _, def := range op.VariableDefinitions {
+			h.add(h.at(def.Position, 1), semanticVariable, semanticDeclaration)
+			h.typeRef(def.Type)
+			h.value(def.DefaultValue, def.Type)
+			h.directives(def.Directives)
+		}
+		h.directives(op.Directives)
+		var root *ast.Definition
+		if h.schema != nil {
+			root = rootTypeForOperation(h.schema, op.Operation)
+		}
+		h.selectionSet(op.SelectionSet, root)
+	}
+	for _, fragment := range doc.Fragments {
+		h.add(h.at(fragment.Position, 1), semanticFragment, semanticDeclaration)
+		if i := h.at(fragment.Position, 2); h.t.isName(i, "on") {
+			h.typeName(i+1, false)
+		}
+		h.directives(fragment.Directives)
+		h.selectionSet(fragment.SelectionSet, h.definition(fragment.TypeCondition))
+	}
+}
+
+// selectionSet classifies the selections of set, made on parent if known.
+func (h *highlighter) selectionSet(set ast.SelectionSet, parent *ast.Definition) {
+	for _, selection := range set {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			i := h.t.index(sel.Position)
+			if i >= 0 && h.t.kindAt(i+1) == lexer.Colon {
+				h.add(i, semanticProperty, 0)
+				i += 2
+			}
+			def := findFieldDefinition(parent, sel.Name)
+			modifiers := 0
+			var args ast.ArgumentDefinitionList
+			var child *ast.Definition
+			if def != nil {
+				modifiers = deprecatedModifier(def.Directives)
+				args = def.Arguments
+				child = h.definition(def.Type.Name())
+			}
+			h.add(i, semanticProperty, modifiers)
+			h.arguments(sel.Arguments, args)
+			h.directives(sel.Directives)
+			h.selectionSet(sel.SelectionSet, child)
+		case *ast.FragmentSpread:
+			h.add(h.t.index(sel.Position), semanticFragment, 0)
+			h.directives(sel.Directives)
+		case *ast.InlineFragment:
+			next := parent
+			if i := h.t.index(sel.Position); h.t.isName(i, "on") {
+				h.typeName(i+1, false)
+				next = h.definition(sel.TypeCondition)
+			}
+			h.directives(sel.Directives)
+			h.selectionSet(sel.SelectionSet, next)
+		}
+	}
+}
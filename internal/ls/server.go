@@ -1,7 +1,9 @@
 package ls
 
 import (
+	"context"
 	"log/slog"
+	"sync"
 
 	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
@@ -14,27 +16,45 @@ var (
 )
 
 type Server struct {
-	handler protocol.Handler
-	state   *State
+	handler     protocol.Handler
+	state       *State
+	diagnostics *diagnosticsScheduler
+	// loadMu serializes schema reloads between handlers and scheduled runs.
+	loadMu sync.Mutex
+	// fetches tracks the schema endpoint fetches running in the background.
+	fetches sync.WaitGroup
 }
 
 func New() *Server {
 	s := &Server{
-		state: newState(),
+		state:       newState(),
+		diagnostics: newDiagnosticsScheduler(diagnosticsDelay),
 	}
 	s.handler = protocol.Handler{
-		Initialize:             s.initialize,
-		Shutdown:               s.shutdown,
-		SetTrace:               s.setTrace,
-		TextDocumentDidOpen:    s.didOpen,
-		TextDocumentDidChange:  s.didChange,
-		TextDocumentDidClose:   s.didClose,
-		TextDocumentDidSave:    s.didSave,
-		TextDocumentHover:      s.hover,
-		TextDocumentDefinition: s.definition,
-		TextDocumentReferences: s.references,
-		TextDocumentRename:     s.rename,
-		TextDocumentCompletion: s.completion,
+		Initialize:                      s.initialize,
+		Initialized:                     s.initialized,
+		Shutdown:                        s.shutdown,
+		SetTrace:                        s.setTrace,
+		TextDocumentDidOpen:             s.didOpen,
+		TextDocumentDidChange:           s.didChange,
+		TextDocumentDidClose:            s.didClose,
+		TextDocumentDidSave:             s.didSave,
+		TextDocumentHover:               s.hover,
+		TextDocumentDefinition:          s.definition,
+		TextDocumentTypeDefinition:      s.typeDefinition,
+		TextDocumentReferences:          s.references,
+		TextDocumentImplementation:      s.implementation,
+		TextDocumentRename:              s.rename,
+		TextDocumentPrepareRename:       s.prepareRename,
+		TextDocumentCompletion:          s.completion,
+		TextDocumentDocumentSymbol:      s.documentSymbol,
+		TextDocumentFormatting:          s.formatting,
+		TextDocumentRangeFormatting:     s.rangeFormatting,
+		TextDocumentSemanticTokensFull:  s.semanticTokensFull,
+		TextDocumentSemanticTokensRange: s.semanticTokensRange,
+		WorkspaceSymbol:                 s.workspaceSymbol,
+		WorkspaceExecuteCommand:         s.executeCommand,
+		WorkspaceDidChangeWatchedFiles:  s.didChangeWatchedFiles,
 	}
 	return s
 }
@@ -55,8 +75,15 @@ func (s *Server) initialize(_ *glsp.Context, params *protocol.InitializeParams)
 	}
 	capabilities.TextDocumentSync.(*protocol.TextDocumentSyncOptions).Save = &protocol.True
 	capabilities.CompletionProvider = &protocol.CompletionOptions{
-		TriggerCharacters: []string{"@", ":", " "},
+		TriggerCharacters: []string{"@", ":", " ", "$", "."},
 	}
+	capabilities.ExecuteCommandProvider = &protocol.ExecuteCommandOptions{
+		Commands: []string{refreshSchemaCommand},
+	}
+	capabilities.RenameProvider = &protocol.RenameOptions{
+		PrepareProvider: &protocol.True,
+	}
+	capabilities.SemanticTokensProvider.(*protocol.SemanticTokensOptions).Legend = semanticTokensLegend()
 
 	rootPath := ""
 	if params.RootURI != nil {
@@ -64,11 +91,19 @@ func (s *Server) initialize(_ *glsp.Context, params *protocol.InitializeParams)
 	} else if params.RootPath != nil {
 		rootPath = *params.RootPath
 	}
-	schemaPaths := readInitializationOptions(params.InitializationOptions)
+	options := readInitializationOptions(params.InitializationOptions)
+	schemaPaths := options.SchemaPaths
+	watchFiles := false
+	if workspace := params.Capabilities.Workspace; workspace != nil && workspace.DidChangeWatchedFiles != nil {
+		watchFiles = workspace.DidChangeWatchedFiles.DynamicRegistration != nil && *workspace.DidChangeWatchedFiles.DynamicRegistration
+	}
 	s.state.mu.Lock()
 	s.state.rootPath = rootPath
 	s.state.schemaPaths = schemaPaths
+	s.state.printWidth = options.PrintWidth
+	s.state.watchFiles = watchFiles
 	s.state.mu.Unlock()
+	s.loadProjectConfig()
 	slog.Debug("initialize configuration", "rootPath", rootPath, "schemaPaths", schemaPaths)
 
 	return protocol.InitializeResult{
@@ -82,6 +117,7 @@ func (s *Server) initialize(_ *glsp.Context, params *protocol.InitializeParams)
 
 func (s *Server) shutdown(_ *glsp.Context) error {
 	slog.Debug("shutdown request received")
+	s.stopEndpointTimers()
 	protocol.SetTraceValue(protocol.TraceValueOff)
 	return nil
 }
@@ -94,8 +130,12 @@ func (s *Server) setTrace(_ *glsp.Context, params *protocol.SetTraceParams) erro
 
 func (s *Server) didOpen(ctx *glsp.Context, params *protocol.DidOpenTextDocumentParams) error {
 	slog.Debug("didOpen", "uri", params.TextDocument.URI, "version", params.TextDocument.Version)
+	if isConfigURI(params.TextDocument.URI) {
+		return nil
+	}
 	s.state.mu.Lock()
 	s.state.docs[params.TextDocument.URI] = params.TextDocument.Text
+	s.state.versions[params.TextDocument.URI] = params.TextDocument.Version
 	s.state.mu.Unlock()
 
 	s.publishQueryDiagnostics(ctx, params.TextDocument.URI, params.TextDocument.Text)
@@ -104,7 +144,7 @@ func (s *Server) didOpen(ctx *glsp.Context, params *protocol.DidOpenTextDocument
 }
 
 func (s *Server) didChange(ctx *glsp.Context, params *protocol.DidChangeTextDocumentParams) error {
-	if len(params.ContentChanges) == 0 {
+	if len(params.ContentChanges) == 0 || isConfigURI(params.TextDocument.URI) {
 		return nil
 	}
 
@@ -119,20 +159,42 @@ func (s *Server) didChange(ctx *glsp.Context, params *protocol.DidChangeTextDocu
 	}
 	logChangeSummary(params.TextDocument.URI, params.TextDocument.Version, params.ContentChanges, len(text))
 
+	uri := params.TextDocument.URI
 	s.state.mu.Lock()
-	s.state.docs[params.TextDocument.URI] = text
+	s.state.docs[uri] = text
+	s.state.versions[uri] = params.TextDocument.Version
 	s.state.mu.Unlock()
 
-	s.publishQueryDiagnostics(ctx, params.TextDocument.URI, text)
-	s.loadWorkspaceSchema(ctx)
+	s.diagnostics.schedule(uri, func(runCtx context.Context) {
+		s.refreshChangedDocument(runCtx, ctx, uri)
+	})
 	return nil
 }
 
+// refreshChangedDocument recomputes diagnostics after a change to uri. It
+// stops between steps once a newer change cancels runCtx.
+func (s *Server) refreshChangedDocument(runCtx context.Context, ctx *glsp.Context, uri protocol.DocumentUri) {
+	s.state.mu.Lock()
+	text, ok := s.state.docs[uri]
+	s.state.mu.Unlock()
+	if !ok || runCtx.Err() != nil {
+		return
+	}
+	s.publishQueryDiagnostics(ctx, uri, text)
+	if runCtx.Err() != nil {
+		return
+	}
+	s.loadWorkspaceSchema(ctx)
+}
+
 func (s *Server) didClose(ctx *glsp.Context, params *protocol.DidCloseTextDocumentParams) error {
 	slog.Debug("didClose", "uri", params.TextDocument.URI)
+	s.diagnostics.cancel(params.TextDocument.URI)
 	s.state.mu.Lock()
 	delete(s.state.docs, params.TextDocument.URI)
+	delete(s.state.versions, params.TextDocument.URI)
 	delete(s.state.queryDiagnostics, params.TextDocument.URI)
+	delete(s.state.queryVersions, params.TextDocument.URI)
 	s.state.mu.Unlock()
 
 	s.loadWorkspaceSchema(ctx)
@@ -142,6 +204,16 @@ func (s *Server) didClose(ctx *glsp.Context, params *protocol.DidCloseTextDocume
 
 func (s *Server) didSave(ctx *glsp.Context, params *protocol.DidSaveTextDocumentParams) error {
 	slog.Debug("didSave", "uri", params.TextDocument.URI)
+	s.state.mu.Lock()
+	watchFiles := s.state.watchFiles
+	s.state.mu.Unlock()
+	if isConfigURI(params.TextDocument.URI) {
+		s.loadProjectConfig()
+	} else if !watchFiles {
+		// Without file watchers, saves are the only hint that files were
+		// added or removed.
+		s.state.index.invalidateScans()
+	}
 	s.loadWorkspaceSchema(ctx)
 	return nil
 }
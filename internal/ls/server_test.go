@@ -1,11 +1,20 @@
 package ls
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+	"unicode/utf16"
 	"unicode/utf8"
 
 	"github.com/tliron/glsp"
@@ -52,6 +61,1155 @@ func TestInitializeSetsStateAndCapabilities(t *testing.T) {
 	}
 }
 
+func TestProjectConfigFile(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	files := map[string]string{
+		".graphqlrc.yaml":            "schema: api/*.graphqls\ndocuments:\n  - src/**/*.graphql\nexclude: src/generated/**\n",
+		"api/schema.graphqls":        "type Query { ok: String }\n",
+		"legacy/schema.graphqls":     "type Query { legacy: String }\n",
+		"src/pages/home.graphql":     "query Home { ok }\n",
+		"src/generated/gen.graphql":  "query Generated { ok }\n",
+		"scripts/unrelated.graphql":  "query Unrelated { ok }\n",
+		"api/extra/nested.graphqls":  "type Nested { id: ID }\n",
+		"src/pages/schema.graphqls":  "type Ignored { id: ID }\n",
+		"src/pages/fragment.graphql": "fragment F on Query { ok }\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	ctx := &glsp.Context{
+		Notify: func(_ string, _ any) {},
+	}
+	s.loadWorkspaceSchema(ctx)
+
+	s.state.mu.Lock()
+	schema := s.state.schema
+	schemaURIs := len(s.state.schemaURIs)
+	s.state.mu.Unlock()
+	if schema == nil || schema.Query.Fields.ForName("ok") == nil || schemaURIs != 1 {
+		t.Fatalf("expected schema from config, got %d sources", schemaURIs)
+	}
+
+	var names []string
+	for _, source := range s.collectDocumentSources(&s.state.project) {
+		rel, _ := filepath.Rel(root, uriToPath(protocol.DocumentUri(source.Name)))
+		names = append(names, filepath.ToSlash(rel))
+	}
+	if strings.Join(names, ",") != "src/pages/fragment.graphql,src/pages/home.graphql" {
+		t.Fatalf("unexpected documents: %v", names)
+	}
+
+	configPath := filepath.Join(root, ".graphqlrc.yaml")
+	if err := os.WriteFile(configPath, []byte(`{"schema": ["legacy/schema.graphqls"]}`), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	if err := s.didSave(ctx, &protocol.DidSaveTextDocumentParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: pathToURI(configPath)},
+	}); err != nil {
+		t.Fatalf("didSave error: %v", err)
+	}
+	s.state.mu.Lock()
+	schema = s.state.schema
+	s.state.mu.Unlock()
+	if schema == nil || schema.Query.Fields.ForName("legacy") == nil {
+		t.Fatal("expected schema to reload after config change")
+	}
+}
+
+func TestSchemaPathsCombineWithConfig(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	files := map[string]string{
+		".graphqlrc.yml":          "schema: api/schema.graphqls\n",
+		"api/schema.graphqls":     "type Query { ok: String }\n",
+		"local/extra.graphqls":    "extend type Query { extra: String }\n",
+		"unused/ignored.graphqls": "type Ignored { id: ID }\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{
+		RootURI: &rootURI,
+		InitializationOptions: map[string]any{
+			"schemaPaths": []string{"local/*.graphqls", "api/schema.graphqls"},
+		},
+	}); err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	s.loadWorkspaceSchema(&glsp.Context{Notify: func(string, any) {}})
+
+	s.state.mu.Lock()
+	schema := s.state.schema
+	schemaURIs := len(s.state.schemaURIs)
+	s.state.mu.Unlock()
+	if schema == nil || schema.Query.Fields.ForName("ok") == nil || schema.Query.Fields.ForName("extra") == nil || schemaURIs != 2 {
+		t.Fatalf("expected schemaPaths and the config schema together, got %d sources", schemaURIs)
+	}
+}
+
+func TestMultipleProjects(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	files := map[string]string{
+		"graphql.config.json": `{"projects": {
+  "public": {"schema": "public/schema.graphqls", "documents": "public/ops"},
+  "admin": {"schema": "admin/schema.graphqls", "documents": ["admin/ops/**/*.graphql"]}
+}}`,
+		"public/schema.graphqls":      "type Query { products: [String] }\n",
+		"admin/schema.graphqls":       "type Query { users: [String] }\n",
+		"public/ops/products.graphql": "query Products { products }\n",
+		"admin/ops/users.graphql":     "query Users { users }\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	published := make(map[protocol.DocumentUri][]protocol.Diagnostic)
+	ctx := &glsp.Context{
+		Notify: func(_ string, params any) {
+			if value, ok := params.(protocol.PublishDiagnosticsParams); ok {
+				published[value.URI] = value.Diagnostics
+			}
+		},
+	}
+	adminQuery := filepath.Join(root, "admin", "ops", "users.graphql")
+	adminURI := pathToURI(adminQuery)
+	if err := s.didOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{
+			URI:        adminURI,
+			LanguageID: "graphql",
+			Version:    1,
+			Text:       files["admin/ops/users.graphql"],
+		},
+	}); err != nil {
+		t.Fatalf("didOpen error: %v", err)
+	}
+
+	for uri, diagnostics := range published {
+		if len(diagnostics) != 0 {
+			t.Fatalf("unexpected diagnostics for %s: %#v", uri, diagnostics)
+		}
+	}
+	if p := s.projectForURI(adminURI); p.name != "admin" {
+		t.Fatalf("expected admin project, got %q", p.name)
+	}
+	publicURI := pathToURI(filepath.Join(root, "public", "ops", "products.graphql"))
+	if p := s.projectForURI(publicURI); p.name != "public" {
+		t.Fatalf("expected public project, got %q", p.name)
+	}
+
+	hover, err := s.hover(nil, &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: adminURI},
+			Position:     protocol.Position{Line: 0, Character: 15},
+		},
+	})
+	if err != nil {
+		t.Fatalf("hover error: %v", err)
+	}
+	if hover == nil {
+		t.Fatal("expected hover from admin schema")
+	}
+	content, ok := hover.Contents.(protocol.MarkupContent)
+	if !ok || !strings.Contains(content.Value, "users: [String]") {
+		t.Fatalf("expected admin field hover, got %#v", hover.Contents)
+	}
+}
+
+const testIntrospection = `{
+  "data": {
+    "__schema": {
+      "queryType": {"name": "Query"},
+      "mutationType": null,
+      "subscriptionType": null,
+      "types": [
+        {"kind": "OBJECT", "name": "Query", "description": null, "fields": [
+          {"name": "user", "description": "Looks up a user.", "args": [
+            {"name": "id", "description": null, "type": {"kind": "NON_NULL", "name": null, "ofType": {"kind": "SCALAR", "name": "ID", "ofType": null}}, "defaultValue": null}
+          ], "type": {"kind": "OBJECT", "name": "User", "ofType": null}, "isDeprecated": false, "deprecationReason": null}
+        ], "inputFields": null, "interfaces": [], "enumValues": null, "possibleTypes": null},
+        {"kind": "OBJECT", "name": "User", "description": null, "fields": [
+          {"name": "name", "description": null, "args": [], "type": {"kind": "SCALAR", "name": "String", "ofType": null}, "isDeprecated": false, "deprecationReason": null}
+        ], "inputFields": null, "interfaces": [], "enumValues": null, "possibleTypes": null},
+        {"kind": "SCALAR", "name": "ID", "description": null, "fields": null, "inputFields": null, "interfaces": null, "enumValues": null, "possibleTypes": null},
+        {"kind": "SCALAR", "name": "String", "description": null, "fields": null, "inputFields": null, "interfaces": null, "enumValues": null, "possibleTypes": null}
+      ],
+      "directives": [
+        {"name": "deprecated", "description": null, "locations": ["FIELD_DEFINITION"], "args": []}
+      ]
+    }
+  }
+}
+`
+
+func TestIntrospectionSchema(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	files := map[string]string{
+		"graphql.config.json": `{"schema": "schema.json"}`,
+		"schema.json":         testIntrospection,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	published := make(map[protocol.DocumentUri][]protocol.Diagnostic)
+	ctx := &glsp.Context{
+		Notify: func(_ string, params any) {
+			if value, ok := params.(protocol.PublishDiagnosticsParams); ok {
+				published[value.URI] = value.Diagnostics
+			}
+		},
+	}
+	queryURI := pathToURI(filepath.Join(root, "query.graphql"))
+	if err := s.didOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{
+			URI:        queryURI,
+			LanguageID: "graphql",
+			Version:    1,
+			Text:       "query User { user(id: \"1\") { name email } }\n",
+		},
+	}); err != nil {
+		t.Fatalf("didOpen error: %v", err)
+	}
+
+	schemaURI := pathToURI(filepath.Join(root, "schema.json"))
+	if diagnostics := published[schemaURI]; len(diagnostics) != 0 {
+		t.Fatalf("unexpected schema diagnostics: %#v", diagnostics)
+	}
+	diagnostics := published[queryURI]
+	if len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "email") {
+		t.Fatalf("expected unknown field diagnostic, got %#v", diagnostics)
+	}
+
+	hover, err := s.hover(nil, &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: queryURI},
+			Position:     protocol.Position{Line: 0, Character: 14},
+		},
+	})
+	if err != nil {
+		t.Fatalf("hover error: %v", err)
+	}
+	if hover == nil {
+		t.Fatal("expected hover from introspection schema")
+	}
+	content, ok := hover.Contents.(protocol.MarkupContent)
+	if !ok || !strings.Contains(content.Value, "Looks up a user.") {
+		t.Fatalf("expected field description in hover, got %#v", hover.Contents)
+	}
+
+	result, err := s.definition(nil, &protocol.DefinitionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: queryURI},
+			Position:     protocol.Position{Line: 0, Character: 14},
+		},
+	})
+	if err != nil {
+		t.Fatalf("definition error: %v", err)
+	}
+	locations, ok := result.([]protocol.Location)
+	if !ok || len(locations) == 0 {
+		t.Fatalf("expected locations, got %T", result)
+	}
+	line := strings.Split(testIntrospection, "\n")[locations[0].Range.Start.Line]
+	if locations[0].URI != schemaURI || !strings.Contains(line, `"name": "user"`) {
+		t.Fatalf("expected definition in introspection file, got %#v", locations[0])
+	}
+}
+
+func TestJSONDocumentSkipsQueryDiagnostics(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "schema.graphqls"), []byte("type Query { user: String }\n"), 0o644); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	ctx := &glsp.Context{Notify: func(string, any) {}}
+	// package.json is open in the editor but not a schema source.
+	uri := pathToURI(filepath.Join(root, "package.json"))
+	if err := s.didOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, LanguageID: "json", Version: 1, Text: "{\"name\": \"app\"}\n"},
+	}); err != nil {
+		t.Fatalf("didOpen error: %v", err)
+	}
+	s.loadWorkspaceSchema(ctx)
+	s.state.mu.Lock()
+	diagnostics := s.state.queryDiagnostics[uri]
+	s.state.mu.Unlock()
+	if len(diagnostics) != 0 {
+		t.Fatalf("expected no query diagnostics for a JSON document, got %#v", diagnostics)
+	}
+}
+
+func TestEndpointSchema(t *testing.T) {
+	t.Setenv("TEST_API_TOKEN", "secret")
+	var requests atomic.Int32
+	var down atomic.Bool
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if down.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, testIntrospection)
+	}))
+	defer endpoint.Close()
+
+	s := New()
+	s.state.cacheDir = t.TempDir()
+	root := t.TempDir()
+	config := fmt.Sprintf(`schema:
+  - %s:
+      headers:
+        Authorization: Bearer ${TEST_API_TOKEN}
+`, endpoint.URL)
+	if err := os.WriteFile(filepath.Join(root, ".graphqlrc.yml"), []byte(config), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	var mu sync.Mutex
+	published := make(map[protocol.DocumentUri][]protocol.Diagnostic)
+	ctx := &glsp.Context{
+		Notify: func(_ string, params any) {
+			if value, ok := params.(protocol.PublishDiagnosticsParams); ok {
+				mu.Lock()
+				published[value.URI] = value.Diagnostics
+				mu.Unlock()
+			}
+		},
+	}
+	queryURI := pathToURI(filepath.Join(root, "query.graphql"))
+	if err := s.didOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{
+			URI:        queryURI,
+			LanguageID: "graphql",
+			Version:    1,
+			Text:       "query User { user(id: \"1\") { name email } }\n",
+		},
+	}); err != nil {
+		t.Fatalf("didOpen error: %v", err)
+	}
+	// The fetch runs in the background and reloads the schema when it is done.
+	s.fetches.Wait()
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("expected 1 introspection request, got %d", n)
+	}
+	mu.Lock()
+	diagnostics := published[queryURI]
+	mu.Unlock()
+	if len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "email") {
+		t.Fatalf("expected unknown field diagnostic, got %#v", diagnostics)
+	}
+
+	// Later reloads reuse the fetched schema until a refresh is requested.
+	if err := s.didSave(ctx, &protocol.DidSaveTextDocumentParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: queryURI},
+	}); err != nil {
+		t.Fatalf("didSave error: %v", err)
+	}
+	s.fetches.Wait()
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("expected cached schema, got %d requests", n)
+	}
+
+	down.Store(true)
+	if _, err := s.executeCommand(ctx, &protocol.ExecuteCommandParams{Command: refreshSchemaCommand}); err != nil {
+		t.Fatalf("executeCommand error: %v", err)
+	}
+	s.fetches.Wait()
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("expected a refresh request, got %d requests", n)
+	}
+	if s.schemaForURI(queryURI) == nil {
+		t.Fatal("expected cached schema after failed refresh")
+	}
+	mu.Lock()
+	diagnostics = published[queryURI]
+	mu.Unlock()
+	if len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, "email") {
+		t.Fatalf("expected diagnostics against cached schema, got %#v", diagnostics)
+	}
+	s.state.mu.Lock()
+	_, fetched := s.state.endpointFetches[endpoint.URL]
+	s.state.mu.Unlock()
+	if fetched {
+		t.Fatal("expected a failed fetch not to be recorded")
+	}
+
+	// Reloads leave a failed endpoint alone until its retry timer fires or a
+	// refresh is requested.
+	if err := s.didSave(ctx, &protocol.DidSaveTextDocumentParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: queryURI},
+	}); err != nil {
+		t.Fatalf("didSave error: %v", err)
+	}
+	s.fetches.Wait()
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("expected no retry on reload, got %d requests", n)
+	}
+	if _, err := s.executeCommand(ctx, &protocol.ExecuteCommandParams{Command: refreshSchemaCommand}); err != nil {
+		t.Fatalf("executeCommand error: %v", err)
+	}
+	s.fetches.Wait()
+	if n := requests.Load(); n != 3 {
+		t.Fatalf("expected the refresh to retry, got %d requests", n)
+	}
+	if err := s.shutdown(ctx); err != nil {
+		t.Fatalf("shutdown error: %v", err)
+	}
+}
+
+func TestEndpointSchemaRefreshInterval(t *testing.T) {
+	var requests atomic.Int32
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, testIntrospection)
+	}))
+	defer endpoint.Close()
+
+	s := New()
+	s.state.cacheDir = t.TempDir()
+	root := t.TempDir()
+	config := fmt.Sprintf("schema:\n  - %s:\n      refreshInterval: 20ms\n", endpoint.URL)
+	if err := os.WriteFile(filepath.Join(root, ".graphqlrc.yml"), []byte(config), 0o644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	ctx := &glsp.Context{Notify: func(string, any) {}}
+	s.loadWorkspaceSchema(ctx)
+
+	// No further event arrives; the timer alone fetches the schema again.
+	deadline := time.Now().Add(5 * time.Second)
+	for requests.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected periodic fetches, got %d requests", requests.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := s.shutdown(ctx); err != nil {
+		t.Fatalf("shutdown error: %v", err)
+	}
+	s.fetches.Wait()
+	after := requests.Load()
+	time.Sleep(100 * time.Millisecond)
+	if n := requests.Load(); n != after {
+		t.Fatalf("expected no fetches after shutdown, got %d more", n-after)
+	}
+}
+
+func TestWatchedFilesReloadSchema(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	files := map[string]string{
+		"graphql.config.json": `{"projects": {
+  "public": {"schema": "public/schema.graphqls", "documents": "public/ops"},
+  "admin": {"schema": "admin/schema.graphqls", "documents": "admin/ops"}
+}}`,
+		"public/schema.graphqls":  "type Query { products: [String] }\n",
+		"admin/schema.graphqls":   "type Query { users: [String] }\n",
+		"admin/ops/users.graphql": "query Users { users email }\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	var params protocol.InitializeParams
+	if err := json.Unmarshal([]byte(`{"capabilities": {"workspace": {"didChangeWatchedFiles": {"dynamicRegistration": true}}}}`), &params); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	rootURI := pathToURI(root)
+	params.RootURI = &rootURI
+	if _, err := s.initialize(nil, &params); err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	registered := make(chan protocol.RegistrationParams, 1)
+	published := make(map[protocol.DocumentUri][]protocol.Diagnostic)
+	ctx := &glsp.Context{
+		Notify: func(_ string, params any) {
+			if value, ok := params.(protocol.PublishDiagnosticsParams); ok {
+				published[value.URI] = value.Diagnostics
+			}
+		},
+		Call: func(method string, params any, _ any) {
+			if value, ok := params.(protocol.RegistrationParams); ok && method == string(protocol.ServerClientRegisterCapability) {
+				registered <- value
+			}
+		},
+	}
+	if err := s.initialized(ctx, &protocol.InitializedParams{}); err != nil {
+		t.Fatalf("initialized error: %v", err)
+	}
+	registration := <-registered
+	if len(registration.Registrations) != 1 || registration.Registrations[0].Method != string(protocol.MethodWorkspaceDidChangeWatchedFiles) {
+		t.Fatalf("unexpected registration: %#v", registration)
+	}
+
+	queryURI := pathToURI(filepath.Join(root, "admin", "ops", "users.graphql"))
+	s.state.mu.Lock()
+	s.state.docs[queryURI] = files["admin/ops/users.graphql"]
+	s.state.mu.Unlock()
+	s.loadWorkspaceSchema(ctx)
+	if diagnostics := published[queryURI]; len(diagnostics) != 1 {
+		t.Fatalf("expected unknown field diagnostic, got %#v", diagnostics)
+	}
+	publicSchema := s.state.projects["public"].schema
+
+	schemaPath := filepath.Join(root, "admin", "schema.graphqls")
+	if err := os.WriteFile(schemaPath, []byte("type Query { users: [String] email: String }\n"), 0o644); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+	if err := s.didChangeWatchedFiles(ctx, &protocol.DidChangeWatchedFilesParams{
+		Changes: []protocol.FileEvent{{URI: pathToURI(schemaPath), Type: protocol.FileChangeTypeChanged}},
+	}); err != nil {
+		t.Fatalf("didChangeWatchedFiles error: %v", err)
+	}
+
+	if diagnostics, ok := published[queryURI]; !ok || len(diagnostics) != 0 {
+		t.Fatalf("expected cleared diagnostics after schema change, got %#v", diagnostics)
+	}
+	if field := s.state.projects["admin"].schema.Query.Fields.ForName("email"); field == nil {
+		t.Fatal("expected reloaded admin schema")
+	}
+	if s.state.projects["public"].schema != publicSchema {
+		t.Fatal("expected public project to keep its schema")
+	}
+}
+
+func TestIncrementalSchemaReload(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	schemaPath := filepath.Join(root, "schema.graphqls")
+	if err := os.WriteFile(schemaPath, []byte("type Query { name: String }\n"), 0o644); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	ctx := &glsp.Context{Notify: func(string, any) {}}
+	queryURI := pathToURI(filepath.Join(root, "query.graphql"))
+	if err := s.didOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: queryURI, LanguageID: "graphql", Version: 1, Text: "{ name }"},
+	}); err != nil {
+		t.Fatalf("didOpen error: %v", err)
+	}
+	schema := s.schemaForURI(queryURI)
+	if schema == nil {
+		t.Fatal("expected schema")
+	}
+
+	if err := s.didChange(ctx, &protocol.DidChangeTextDocumentParams{
+		TextDocument: protocol.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: queryURI},
+			Version:                2,
+		},
+		ContentChanges: []any{protocol.TextDocumentContentChangeEventWhole{Text: "{ name __typename }"}},
+	}); err != nil {
+		t.Fatalf("didChange error: %v", err)
+	}
+	s.diagnostics.wait()
+	if s.schemaForURI(queryURI) != schema {
+		t.Fatal("expected schema to be reused when only documents change")
+	}
+
+	if err := os.WriteFile(schemaPath, []byte("type Query { name: String, age: Int }\n"), 0o644); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+	if err := s.didSave(ctx, &protocol.DidSaveTextDocumentParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: pathToURI(schemaPath)},
+	}); err != nil {
+		t.Fatalf("didSave error: %v", err)
+	}
+	rebuilt := s.schemaForURI(queryURI)
+	if rebuilt == schema || rebuilt.Query.Fields.ForName("age") == nil {
+		t.Fatal("expected schema rebuilt from the changed source")
+	}
+	if rebuilt.Types["__Type"] == schema.Types["__Type"] {
+		t.Fatal("expected prelude definitions to be copied per build")
+	}
+}
+
+func TestDidChangeDebouncesDiagnostics(t *testing.T) {
+	s := New()
+	uri := protocol.DocumentUri("file:///tmp/query.graphql")
+	var published []protocol.PublishDiagnosticsParams
+	ctx := &glsp.Context{
+		Notify: func(_ string, params any) {
+			if value, ok := params.(protocol.PublishDiagnosticsParams); ok && value.URI == uri {
+				published = append(published, value)
+			}
+		},
+	}
+	if err := s.didOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, LanguageID: "graphql", Version: 1, Text: "{ name }"},
+	}); err != nil {
+		t.Fatalf("didOpen error: %v", err)
+	}
+	published = nil
+
+	for version, text := range []string{"{ n }", "{ na }", "{ nam"} {
+		if err := s.didChange(ctx, &protocol.DidChangeTextDocumentParams{
+			TextDocument: protocol.VersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+				Version:                protocol.Integer(version + 2),
+			},
+			ContentChanges: []any{protocol.TextDocumentContentChangeEventWhole{Text: text}},
+		}); err != nil {
+			t.Fatalf("didChange error: %v", err)
+		}
+	}
+	s.diagnostics.wait()
+
+	if len(published) == 0 {
+		t.Fatal("expected diagnostics after the changes settled")
+	}
+	for _, params := range published {
+		if params.Version == nil || *params.Version != 4 {
+			t.Fatalf("expected only diagnostics tagged with version 4, got %v", params.Version)
+		}
+		if len(params.Diagnostics) != 1 || !strings.Contains(params.Diagnostics[0].Message, "EOF") {
+			t.Fatalf("expected diagnostics for the latest text, got %#v", params.Diagnostics)
+		}
+	}
+}
+
+func TestStaleQueryDiagnosticsAreNotPublished(t *testing.T) {
+	s := New()
+	uri := protocol.DocumentUri("file:///tmp/query.graphql")
+	var published []protocol.PublishDiagnosticsParams
+	ctx := &glsp.Context{
+		Notify: func(_ string, params any) {
+			if value, ok := params.(protocol.PublishDiagnosticsParams); ok {
+				published = append(published, value)
+			}
+		},
+	}
+	s.state.mu.Lock()
+	s.state.docs[uri] = "{ name }"
+	s.state.versions[uri] = 2
+	s.state.mu.Unlock()
+
+	// Diagnostics computed for text the editor has already replaced.
+	s.updateQueryDiagnostics(uri, "{")
+	s.publishCombinedDiagnostics(ctx, uri)
+	if len(published) != 0 {
+		t.Fatalf("expected stale diagnostics to be dropped, got %#v", published)
+	}
+
+	s.updateQueryDiagnostics(uri, "{ name }")
+	s.publishCombinedDiagnostics(ctx, uri)
+	if len(published) != 1 || published[0].Version == nil || *published[0].Version != 2 {
+		t.Fatalf("expected diagnostics tagged with version 2, got %#v", published)
+	}
+}
+
+func TestDocumentSymbolSchema(t *testing.T) {
+	s := New()
+	uri := protocol.DocumentUri("file:///tmp/schema.graphqls")
+	text := "\"A user\"\ntype User {\n  # the id\n  id: ID!\n  posts(\"max\" first: Int, after: String): [String] @deprecated\n}\n\nenum Role { ADMIN USER }\n\ndirective @auth(role: Role) on FIELD_DEFINITION\n"
+	s.state.mu.Lock()
+	s.state.docs[uri] = text
+	s.state.mu.Unlock()
+
+	result, err := s.documentSymbol(nil, &protocol.DocumentSymbolParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil {
+		t.Fatalf("documentSymbol error: %v", err)
+	}
+	symbols, ok := result.([]protocol.DocumentSymbol)
+	if !ok || len(symbols) != 3 {
+		t.Fatalf("expected 3 symbols, got %#v", result)
+	}
+
+	user := symbols[0]
+	if user.Name != "User" || user.Kind != protocol.SymbolKindClass {
+		t.Fatalf("unexpected first symbol: %#v", user)
+	}
+	wantRange := protocol.Range{Start: protocol.Position{Line: 0, Character: 0}, End: protocol.Position{Line: 5, Character: 1}}
+	if user.Range != wantRange {
+		t.Fatalf("expected type range %#v, got %#v", wantRange, user.Range)
+	}
+	wantSelection := protocol.Range{Start: protocol.Position{Line: 1, Character: 5}, End: protocol.Position{Line: 1, Character: 9}}
+	if user.SelectionRange != wantSelection {
+		t.Fatalf("expected type selection range %#v, got %#v", wantSelection, user.SelectionRange)
+	}
+	if len(user.Children) != 2 {
+		t.Fatalf("expected 2 fields, got %#v", user.Children)
+	}
+	posts := user.Children[1]
+	if posts.Name != "posts" || posts.Detail == nil || *posts.Detail != "[String]" || len(posts.Tags) != 1 {
+		t.Fatalf("unexpected field symbol: %#v", posts)
+	}
+	wantRange = protocol.Range{Start: protocol.Position{Line: 4, Character: 2}, End: protocol.Position{Line: 4, Character: 62}}
+	if posts.Range != wantRange {
+		t.Fatalf("expected field range %#v, got %#v", wantRange, posts.Range)
+	}
+	if len(posts.Children) != 2 || posts.Children[0].Name != "first" || posts.Children[1].Name != "after" {
+		t.Fatalf("unexpected argument symbols: %#v", posts.Children)
+	}
+	wantRange = protocol.Range{Start: protocol.Position{Line: 4, Character: 8}, End: protocol.Position{Line: 4, Character: 24}}
+	if posts.Children[0].Range != wantRange {
+		t.Fatalf("expected argument range %#v, got %#v", wantRange, posts.Children[0].Range)
+	}
+
+	role := symbols[1]
+	if role.Name != "Role" || role.Kind != protocol.SymbolKindEnum || len(role.Children) != 2 || role.Children[1].Name != "USER" {
+		t.Fatalf("unexpected enum symbol: %#v", role)
+	}
+	auth := symbols[2]
+	if auth.Name != "@auth" || len(auth.Children) != 1 || auth.Children[0].Name != "role" {
+		t.Fatalf("unexpected directive symbol: %#v", auth)
+	}
+	wantRange = protocol.Range{Start: protocol.Position{Line: 9, Character: 0}, End: protocol.Position{Line: 9, Character: 47}}
+	if auth.Range != wantRange {
+		t.Fatalf("expected directive range %#v, got %#v", wantRange, auth.Range)
+	}
+}
+
+func TestDocumentSymbolUTF16Columns(t *testing.T) {
+	s := New()
+	uri := protocol.DocumentUri("file:///tmp/schema.graphqls")
+	text := "\"🚀 fast\" type Rocket { id: ID }\n"
+	s.state.mu.Lock()
+	s.state.docs[uri] = text
+	s.state.mu.Unlock()
+
+	result, err := s.documentSymbol(nil, &protocol.DocumentSymbolParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil {
+		t.Fatalf("documentSymbol error: %v", err)
+	}
+	symbols, ok := result.([]protocol.DocumentSymbol)
+	if !ok || len(symbols) != 1 {
+		t.Fatalf("expected 1 symbol, got %#v", result)
+	}
+	// The rocket is one rune but two UTF-16 code units.
+	wantSelection := protocol.Range{Start: protocol.Position{Line: 0, Character: 15}, End: protocol.Position{Line: 0, Character: 21}}
+	if symbols[0].SelectionRange != wantSelection {
+		t.Fatalf("expected selection range %#v, got %#v", wantSelection, symbols[0].SelectionRange)
+	}
+	wantRange := protocol.Range{Start: protocol.Position{Line: 0, Character: 0}, End: protocol.Position{Line: 0, Character: 32}}
+	if symbols[0].Range != wantRange {
+		t.Fatalf("expected range %#v, got %#v", wantRange, symbols[0].Range)
+	}
+}
+
+func TestDocumentSymbolQuery(t *testing.T) {
+	s := New()
+	uri := protocol.DocumentUri("file:///tmp/query.graphql")
+	text := "query GetUser($id: ID!) {\n  me: user(id: $id) {\n    name\n  }\n  ...Extra\n}\n\nfragment Extra on Query {\n  ... on Query { version }\n}\n"
+	s.state.mu.Lock()
+	s.state.docs[uri] = text
+	s.state.mu.Unlock()
+
+	result, err := s.documentSymbol(nil, &protocol.DocumentSymbolParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil {
+		t.Fatalf("documentSymbol error: %v", err)
+	}
+	symbols, ok := result.([]protocol.DocumentSymbol)
+	if !ok || len(symbols) != 2 {
+		t.Fatalf("expected 2 symbols, got %#v", result)
+	}
+
+	op := symbols[0]
+	if op.Name != "GetUser" || op.Detail == nil || *op.Detail != "query" {
+		t.Fatalf("unexpected operation symbol: %#v", op)
+	}
+	wantRange := protocol.Range{Start: protocol.Position{Line: 0, Character: 0}, End: protocol.Position{Line: 5, Character: 1}}
+	if op.Range != wantRange {
+		t.Fatalf("expected operation range %#v, got %#v", wantRange, op.Range)
+	}
+	if len(op.Children) != 2 {
+		t.Fatalf("expected top-level selections only, got %#v", op.Children)
+	}
+	me := op.Children[0]
+	if me.Name != "me" || me.Detail == nil || *me.Detail != "user" {
+		t.Fatalf("unexpected field symbol: %#v", me)
+	}
+	wantRange = protocol.Range{Start: protocol.Position{Line: 1, Character: 2}, End: protocol.Position{Line: 3, Character: 3}}
+	if me.Range != wantRange {
+		t.Fatalf("expected field range %#v, got %#v", wantRange, me.Range)
+	}
+	if op.Children[1].Name != "...Extra" {
+		t.Fatalf("unexpected spread symbol: %#v", op.Children[1])
+	}
+
+	fragment := symbols[1]
+	wantSelection := protocol.Range{Start: protocol.Position{Line: 7, Character: 9}, End: protocol.Position{Line: 7, Character: 14}}
+	if fragment.Name != "Extra" || fragment.SelectionRange != wantSelection {
+		t.Fatalf("unexpected fragment symbol: %#v", fragment)
+	}
+	if len(fragment.Children) != 1 || fragment.Children[0].Name != "... on Query" {
+		t.Fatalf("unexpected fragment selections: %#v", fragment.Children)
+	}
+}
+
+func TestWorkspaceSymbol(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	schemaText := "type Query {\n  orders: [Order]\n  order(id: ID!): Order\n}\n\ntype Order { id: ID! status: Status }\n\nenum Status { OPEN CLOSED }\n\ndirective @auth on FIELD_DEFINITION\n"
+	if err := os.WriteFile(filepath.Join(root, "schema.graphqls"), []byte(schemaText), 0o644); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "orders.graphql"), []byte("query ListOrders { orders { ...OrderRow } }\n\nfragment OrderRow on Order { id status }\n"), 0o644); err != nil {
+		t.Fatalf("write document: %v", err)
+	}
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	s.loadWorkspaceSchema(&glsp.Context{Notify: func(string, any) {}})
+
+	symbols, err := s.workspaceSymbol(nil, &protocol.WorkspaceSymbolParams{Query: "Query.orders"})
+	if err != nil {
+		t.Fatalf("workspaceSymbol error: %v", err)
+	}
+	if len(symbols) == 0 || symbols[0].Name != "Query.orders" || symbols[0].Kind != protocol.SymbolKindField {
+		t.Fatalf("expected Query.orders first, got %#v", symbols)
+	}
+	if symbols[0].ContainerName == nil || *symbols[0].ContainerName != "Query" {
+		t.Fatalf("expected container Query, got %#v", symbols[0].ContainerName)
+	}
+	if symbols[0].Location.URI != pathToURI(filepath.Join(root, "schema.graphqls")) || symbols[0].Location.Range.Start.Line != 1 {
+		t.Fatalf("unexpected Query.orders location: %#v", symbols[0].Location)
+	}
+
+	symbols, err = s.workspaceSymbol(nil, &protocol.WorkspaceSymbolParams{Query: "ordrow"})
+	if err != nil {
+		t.Fatalf("workspaceSymbol error: %v", err)
+	}
+	if len(symbols) != 1 || symbols[0].Name != "OrderRow" || symbols[0].Location.Range.Start.Line != 2 {
+		t.Fatalf("expected fragment OrderRow, got %#v", symbols)
+	}
+
+	names := make(map[string]bool)
+	symbols, _ = s.workspaceSymbol(nil, &protocol.WorkspaceSymbolParams{})
+	for _, symbol := range symbols {
+		names[symbol.Name] = true
+	}
+	for _, name := range []string{"Query", "Order.status", "Status.CLOSED", "@auth", "ListOrders", "OrderRow"} {
+		if !names[name] {
+			t.Fatalf("expected symbol %s, got %v", name, names)
+		}
+	}
+	for _, name := range []string{"String", "@deprecated", "__Type"} {
+		if names[name] {
+			t.Fatalf("expected built-in %s to be left out", name)
+		}
+	}
+}
+
+func TestFormattingSchema(t *testing.T) {
+	s := New()
+	uri := protocol.DocumentUri("file:///tmp/schema.graphqls")
+	text := "# Types\n\"\"\"\n    The root.\n\"\"\"\ntype Query implements & Node {   # root\n    id: ID!\n  # lookups\n  user(id: ID!, \"Include drafts\" drafts: Boolean = false): User @deprecated(reason: \"use node\")\n}\nunion Result = | Query | User\n"
+	s.state.mu.Lock()
+	s.state.docs[uri] = text
+	s.state.mu.Unlock()
+
+	edits, err := s.formatting(nil, &protocol.DocumentFormattingParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Options:      protocol.FormattingOptions{protocol.FormattingOptionTabSize: float64(2), protocol.FormattingOptionInsertSpaces: true},
+	})
+	if err != nil {
+		t.Fatalf("formatting error: %v", err)
+	}
+	got := text
+	for i := len(edits) - 1; i >= 0; i-- {
+		got = applyRangeChange(got, edits[i].Range, edits[i].NewText)
+	}
+	want := "# Types\n\"\"\"\nThe root.\n\"\"\"\ntype Query implements Node { # root\n  id: ID!\n  # lookups\n  user(\n    id: ID!\n    \"Include drafts\"\n    drafts: Boolean = false\n  ): User @deprecated(reason: \"use node\")\n}\n\nunion Result = Query | User\n"
+	if got != want {
+		t.Fatalf("unexpected formatting:\n%s\nwant:\n%s", got, want)
+	}
+	if len(edits) == 0 || edits[0].Range.Start.Line != 2 {
+		t.Fatalf("expected the unchanged leading lines to be left alone, got %#v", edits)
+	}
+	if again, err := formatDocument(got, true, defaultFormatOptions()); err != nil || again != got {
+		t.Fatalf("expected formatting to be stable, got %q (%v)", again, err)
+	}
+}
+
+func TestFormattingWrapsPastPrintWidth(t *testing.T) {
+	s := New()
+	uri := protocol.DocumentUri("file:///tmp/query.graphql")
+	text := "query Search($term: String!, $first: Int = 10) { search(term: $term, first: $first) { id } }\n"
+	s.state.mu.Lock()
+	s.state.docs[uri] = text
+	s.state.mu.Unlock()
+
+	format := func(width int) string {
+		edits, err := s.formatting(nil, &protocol.DocumentFormattingParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Options:      protocol.FormattingOptions{printWidthOption: float64(width)},
+		})
+		if err != nil {
+			t.Fatalf("formatting error: %v", err)
+		}
+		got := text
+		for i := len(edits) - 1; i >= 0; i-- {
+			got = applyRangeChange(got, edits[i].Range, edits[i].NewText)
+		}
+		return got
+	}
+
+	want := "query Search($term: String!, $first: Int = 10) {\n  search(term: $term, first: $first) {\n    id\n  }\n}\n"
+	if got := format(80); got != want {
+		t.Fatalf("unexpected formatting at width 80:\n%s", got)
+	}
+	want = "query Search(\n  $term: String!\n  $first: Int = 10\n) {\n  search(\n    term: $term\n    first: $first\n  ) {\n    id\n  }\n}\n"
+	if got := format(30); got != want {
+		t.Fatalf("unexpected formatting at width 30:\n%s", got)
+	}
+}
+
+func TestRangeFormattingOnlyTouchesSelectedDefinitions(t *testing.T) {
+	s := New()
+	uri := protocol.DocumentUri("file:///tmp/schema.graphqls")
+	text := "type A {\n    a: Int\n}\n\ntype B {\n    b: Int\n    c: Int\n}\n"
+	s.state.mu.Lock()
+	s.state.docs[uri] = text
+	s.state.mu.Unlock()
+
+	edits, err := s.rangeFormatting(nil, &protocol.DocumentRangeFormattingParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Range: protocol.Range{
+			Start: protocol.Position{Line: 6, Character: 0},
+			End:   protocol.Position{Line: 6, Character: 4},
+		},
+	})
+	if err != nil {
+		t.Fatalf("rangeFormatting error: %v", err)
+	}
+	if len(edits) != 1 || edits[0].Range.Start.Line != 5 || edits[0].Range.End.Line != 7 || edits[0].NewText != "  b: Int\n  c: Int\n" {
+		t.Fatalf("expected only the fields of B to be reindented, got %#v", edits)
+	}
+}
+
+func TestFormattingSkipsInvalidDocuments(t *testing.T) {
+	s := New()
+	uri := protocol.DocumentUri("file:///tmp/query.graphql")
+	s.state.mu.Lock()
+	s.state.docs[uri] = "{ user { name }"
+	s.state.mu.Unlock()
+
+	edits, err := s.formatting(nil, &protocol.DocumentFormattingParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	if err != nil || edits != nil {
+		t.Fatalf("expected no edits for a document with syntax errors, got %#v (%v)", edits, err)
+	}
+}
+
+func TestSemanticTokens(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	schemaText := "interface Node { id: ID! }\n\ntype User implements Node {\n  id: ID!\n  name: String @deprecated(reason: \"use fullName\")\n  posts(order: Order = NEWEST): [Post!]!\n}\n\ntype Post { title: String }\n\nenum Order { NEWEST OLDEST @deprecated }\n\ntype Query { user(id: ID!): User }\n"
+	if err := os.WriteFile(filepath.Join(root, "schema.graphqls"), []byte(schemaText), 0o644); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+	rootURI := pathToURI(root)
+	result, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI})
+	if err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	legend := result.(protocol.InitializeResult).Capabilities.SemanticTokensProvider.(*protocol.SemanticTokensOptions).Legend
+	s.loadWorkspaceSchema(&glsp.Context{Notify: func(string, any) {}})
+
+	uri := pathToURI(filepath.Join(root, "query.graphql"))
+	queryText := "query Profile($id: ID!) {\n  user(id: $id) {\n    ...Names\n    posts(order: OLDEST) { title }\n  }\n}\n\nfragment Names on User { name @include(if: true) }\n"
+	s.state.mu.Lock()
+	s.state.docs[uri] = queryText
+	s.state.mu.Unlock()
+
+	tokens, err := s.semanticTokensFull(nil, &protocol.SemanticTokensParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+	if err != nil || tokens == nil {
+		t.Fatalf("semanticTokensFull: %v, %v", tokens, err)
+	}
+	got := decodeSemanticTokens(queryText, tokens.Data, legend)
+	want := []string{
+		"Profile function declaration",
+		"$id variable declaration",
+		"ID type defaultLibrary scalar",
+		"user property",
+		"id parameter",
+		"$id variable",
+		"Names class",
+		"posts property",
+		"order parameter",
+		"OLDEST enumMember deprecated",
+		"title property",
+		"Names class declaration",
+		"User type",
+		"name property deprecated",
+		"@include decorator defaultLibrary",
+		"if parameter",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected query tokens:\n%s", strings.Join(got, "\n"))
+	}
+
+	schemaURI := pathToURI(filepath.Join(root, "schema.graphqls"))
+	tokens, err = s.semanticTokensFull(nil, &protocol.SemanticTokensParams{TextDocument: protocol.TextDocumentIdentifier{URI: schemaURI}})
+	if err != nil || tokens == nil {
+		t.Fatalf("semanticTokensFull: %v, %v", tokens, err)
+	}
+	got = decodeSemanticTokens(schemaText, tokens.Data, legend)
+	want = []string{
+		"Node type declaration interface",
+		"id property declaration",
+		"ID type defaultLibrary scalar",
+		"User type declaration",
+		"Node type interface",
+		"id property declaration",
+		"ID type defaultLibrary scalar",
+		"name property declaration deprecated",
+		"String type defaultLibrary scalar",
+		"@deprecated decorator defaultLibrary",
+		"reason parameter",
+		"posts property declaration",
+		"order parameter declaration",
+		"Order type enum",
+		"NEWEST enumMember",
+		"Post type",
+	}
+	if strings.Join(got[:len(want)], "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected schema tokens:\n%s", strings.Join(got, "\n"))
+	}
+
+	ranged, err := s.semanticTokensRange(nil, &protocol.SemanticTokensRangeParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Range:        protocol.Range{Start: protocol.Position{Line: 7}, End: protocol.Position{Line: 8}},
+	})
+	if err != nil {
+		t.Fatalf("semanticTokensRange error: %v", err)
+	}
+	got = decodeSemanticTokens(queryText, ranged.(*protocol.SemanticTokens).Data, legend)
+	if len(got) != 5 || got[0] != "Names class declaration" {
+		t.Fatalf("expected only the fragment line, got %v", got)
+	}
+
+	// Columns count UTF-16 code units, so names after an emoji stay aligned.
+	emojiURI := pathToURI(filepath.Join(root, "emoji.graphql"))
+	emojiText := "{ user(id: \"🚀\") { name } }\n"
+	s.state.mu.Lock()
+	s.state.docs[emojiURI] = emojiText
+	s.state.mu.Unlock()
+	tokens, err = s.semanticTokensFull(nil, &protocol.SemanticTokensParams{TextDocument: protocol.TextDocumentIdentifier{URI: emojiURI}})
+	if err != nil || tokens == nil {
+		t.Fatalf("semanticTokensFull: %v, %v", tokens, err)
+	}
+	got = decodeSemanticTokens(emojiText, tokens.Data, legend)
+	want = []string{"user property", "id parameter", "name property deprecated"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected tokens after emoji:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func decodeSemanticTokens(text string, data []protocol.UInteger, legend protocol.SemanticTokensLegend) []string {
+	lines := strings.Split(text, "\n")
+	var result []string
+	line, char := 0, 0
+	for i := 0; i+4 < len(data); i += 5 {
+		if data[i] > 0 {
+			char = 0
+		}
+		line += int(data[i])
+		char += int(data[i+1])
+		units := utf16.Encode([]rune(lines[line]))
+		entry := []string{string(utf16.Decode(units[char : char+int(data[i+2])])), legend.TokenTypes[data[i+3]]}
+		for bit, modifier := range legend.TokenModifiers {
+			if data[i+4]&(1<<bit) != 0 {
+				entry = append(entry, modifier)
+			}
+		}
+		result = append(result, strings.Join(entry, " "))
+	}
+	return result
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"schema/**/*.graphqls", "schema/a.graphqls", true},
+		{"schema/**/*.graphqls", "schema/x/y/a.graphqls", true},
+		{"schema/*.graphqls", "schema/x/a.graphqls", false},
+		{"**/*.{graphql,graphqls}", "a/b.graphql", true},
+		{"**/*.{graphql,graphqls}", "a/b.json", false},
+		{"src/generated/**", "src/generated/a/b.graphql", true},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
 func TestSchemaDiscoveryIncludesGraphQLFiles(t *testing.T) {
 	s := New()
 	root := t.TempDir()
@@ -224,58 +1382,223 @@ func TestDidOpenChangeClosePublishesDiagnostics(t *testing.T) {
 	s := New()
 	uri := protocol.DocumentUri("file:///tmp/query.graphql")
 
-	var published []protocol.PublishDiagnosticsParams
+	var published []protocol.PublishDiagnosticsParams
+	ctx := &glsp.Context{
+		Notify: func(method string, params any) {
+			if method != string(protocol.ServerTextDocumentPublishDiagnostics) {
+				return
+			}
+			value, ok := params.(protocol.PublishDiagnosticsParams)
+			if !ok {
+				t.Fatalf("unexpected diagnostics params type: %T", params)
+			}
+			published = append(published, value)
+		},
+	}
+
+	if err := s.didOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{
+			URI:        uri,
+			LanguageID: "graphql",
+			Version:    1,
+			Text:       "{",
+		},
+	}); err != nil {
+		t.Fatalf("didOpen error: %v", err)
+	}
+	if len(published) == 0 || len(published[len(published)-1].Diagnostics) == 0 {
+		t.Fatal("expected diagnostics on didOpen")
+	}
+
+	if err := s.didChange(ctx, &protocol.DidChangeTextDocumentParams{
+		TextDocument: protocol.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+			Version:                2,
+		},
+		ContentChanges: []any{
+			protocol.TextDocumentContentChangeEventWhole{
+				Text: "{ __typename }",
+			},
+		},
+	}); err != nil {
+		t.Fatalf("didChange error: %v", err)
+	}
+	s.diagnostics.wait()
+	if len(published) == 0 || len(published[len(published)-1].Diagnostics) != 0 {
+		t.Fatal("expected no diagnostics on didChange")
+	}
+
+	if err := s.didClose(ctx, &protocol.DidCloseTextDocumentParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	}); err != nil {
+		t.Fatalf("didClose error: %v", err)
+	}
+	if len(published) == 0 || len(published[len(published)-1].Diagnostics) != 0 {
+		t.Fatal("expected cleared diagnostics on didClose")
+	}
+}
+
+func TestQueryValidationDiagnostics(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	schemaPath := filepath.Join(root, "schema.graphqls")
+	if err := os.WriteFile(schemaPath, []byte("type Query { user: User }\ntype User { name: String }\n"), 0o644); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+	queryPath := filepath.Join(root, "query.graphql")
+	query := "{\n  user {\n    email\n  }\n}\n"
+	if err := os.WriteFile(queryPath, []byte(query), 0o644); err != nil {
+		t.Fatalf("write query: %v", err)
+	}
+
+	s.state.mu.Lock()
+	s.state.rootPath = root
+	s.state.schemaPaths = nil
+	s.state.mu.Unlock()
+
+	uri := pathToURI(queryPath)
+	var published []protocol.Diagnostic
+	ctx := &glsp.Context{
+		Notify: func(_ string, params any) {
+			value, ok := params.(protocol.PublishDiagnosticsParams)
+			if ok && value.URI == uri {
+				published = value.Diagnostics
+			}
+		},
+	}
+	if err := s.didOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{
+			URI:        uri,
+			LanguageID: "graphql",
+			Version:    1,
+			Text:       query,
+		},
+	}); err != nil {
+		t.Fatalf("didOpen error: %v", err)
+	}
+
+	s.state.mu.Lock()
+	_, isSchema := s.state.schemaURIs[uri]
+	s.state.mu.Unlock()
+	if isSchema {
+		t.Fatal("expected query document to be excluded from schema sources")
+	}
+	if len(published) != 1 {
+		t.Fatalf("expected one validation diagnostic, got %#v", published)
+	}
+	diag := published[0]
+	if !strings.Contains(diag.Message, "email") {
+		t.Fatalf("unexpected diagnostic message: %q", diag.Message)
+	}
+	want := protocol.Range{
+		Start: protocol.Position{Line: 2, Character: 4},
+		End:   protocol.Position{Line: 2, Character: 9},
+	}
+	if diag.Range != want {
+		t.Fatalf("expected range %#v, got %#v", want, diag.Range)
+	}
+}
+
+func TestUnusedFragmentDiagnostics(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: "type Query { user: User }\ntype User { name: String }\n"})
+	fragment := "fragment Name on User { name }\n"
+
+	// A fragment-only file is a library for other documents.
+	if diagnostics := queryDiagnostics("file:///tmp/fragments.graphql", fragment, schema, nil); len(diagnostics) != 0 {
+		t.Fatalf("expected no diagnostics for a fragment-only file, got %#v", diagnostics)
+	}
+	diagnostics := queryDiagnostics("file:///tmp/query.graphql", "{ user { name } }\n"+fragment, schema, nil)
+	if len(diagnostics) != 1 || !strings.Contains(diagnostics[0].Message, `Fragment "Name" is never used`) {
+		t.Fatalf("expected an unused fragment diagnostic, got %#v", diagnostics)
+	}
+}
+
+func TestCrossFileFragments(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "schema.graphqls"), []byte("type Query { user: User }\ntype User { name: String }\n"), 0o644); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "fragments"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	fragmentPath := filepath.Join(root, "fragments", "user.graphql")
+	if err := os.WriteFile(fragmentPath, []byte("fragment UserFields on User {\n  name\n}\n"), 0o644); err != nil {
+		t.Fatalf("write fragment: %v", err)
+	}
+	queryPath := filepath.Join(root, "query.graphql")
+	query := "query Q {\n  user {\n    ...UserFields\n    ...Missing\n  }\n}\n"
+	if err := os.WriteFile(queryPath, []byte(query), 0o644); err != nil {
+		t.Fatalf("write query: %v", err)
+	}
+
+	s.state.mu.Lock()
+	s.state.rootPath = root
+	s.state.mu.Unlock()
+
+	uri := pathToURI(queryPath)
+	var published []protocol.Diagnostic
 	ctx := &glsp.Context{
-		Notify: func(method string, params any) {
-			if method != string(protocol.ServerTextDocumentPublishDiagnostics) {
-				return
-			}
+		Notify: func(_ string, params any) {
 			value, ok := params.(protocol.PublishDiagnosticsParams)
-			if !ok {
-				t.Fatalf("unexpected diagnostics params type: %T", params)
+			if ok && value.URI == uri {
+				published = value.Diagnostics
 			}
-			published = append(published, value)
 		},
 	}
-
 	if err := s.didOpen(ctx, &protocol.DidOpenTextDocumentParams{
 		TextDocument: protocol.TextDocumentItem{
 			URI:        uri,
 			LanguageID: "graphql",
 			Version:    1,
-			Text:       "{",
+			Text:       query,
 		},
 	}); err != nil {
 		t.Fatalf("didOpen error: %v", err)
 	}
-	if len(published) == 0 || len(published[len(published)-1].Diagnostics) == 0 {
-		t.Fatal("expected diagnostics on didOpen")
+	if len(published) != 1 || !strings.Contains(published[0].Message, "Missing") {
+		t.Fatalf("expected only the unknown fragment to be reported, got %#v", published)
 	}
 
-	if err := s.didChange(ctx, &protocol.DidChangeTextDocumentParams{
-		TextDocument: protocol.VersionedTextDocumentIdentifier{
-			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
-			Version:                2,
+	result, err := s.definition(nil, &protocol.DefinitionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 2, Character: 8},
 		},
-		ContentChanges: []any{
-			protocol.TextDocumentContentChangeEventWhole{
-				Text: "{ __typename }",
-			},
+	})
+	if err != nil {
+		t.Fatalf("definition error: %v", err)
+	}
+	locations, ok := result.([]protocol.Location)
+	if !ok || len(locations) != 1 {
+		t.Fatalf("expected fragment location, got %#v", result)
+	}
+	want := protocol.Location{
+		URI: pathToURI(fragmentPath),
+		Range: protocol.Range{
+			Start: protocol.Position{Line: 0, Character: 9},
+			End:   protocol.Position{Line: 0, Character: 19},
 		},
-	}); err != nil {
-		t.Fatalf("didChange error: %v", err)
 	}
-	if len(published) == 0 || len(published[len(published)-1].Diagnostics) != 0 {
-		t.Fatal("expected no diagnostics on didChange")
+	if locations[0] != want {
+		t.Fatalf("expected %#v, got %#v", want, locations[0])
 	}
 
-	if err := s.didClose(ctx, &protocol.DidCloseTextDocumentParams{
-		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
-	}); err != nil {
-		t.Fatalf("didClose error: %v", err)
+	hover, err := s.hover(nil, &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: 2, Character: 8},
+		},
+	})
+	if err != nil {
+		t.Fatalf("hover error: %v", err)
 	}
-	if len(published) == 0 || len(published[len(published)-1].Diagnostics) != 0 {
-		t.Fatal("expected cleared diagnostics on didClose")
+	if hover == nil {
+		t.Fatal("expected hover result")
+	}
+	content, ok := hover.Contents.(protocol.MarkupContent)
+	if !ok || !strings.Contains(content.Value, "fragment UserFields on User") {
+		t.Fatalf("expected fragment hover content, got %#v", hover.Contents)
 	}
 }
 
@@ -597,6 +1920,68 @@ func TestReferencesSchemaType(t *testing.T) {
 	}
 }
 
+func TestReferencesSchemaMembersInOperations(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	files := map[string]string{
+		"schema.graphqls": "type Query {\n  orders(status: Status): [Order]\n}\ntype Order { id: ID! status: Status }\nenum Status { OPEN CLOSED }\n" +
+			"input OrderFilter { status: Status = CLOSED statuses: [Status] = [OPEN] }\n" +
+			"type Admin { orders(status: Status = OPEN, filter: OrderFilter = { status: OPEN }): [Order] }\n",
+		"list.graphql": "query Open {\n  open: orders(status: OPEN) { ...Row }\n}\n",
+		"row.graphql":  "fragment Row on Order { id status }\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	s.loadWorkspaceSchema(&glsp.Context{Notify: func(string, any) {}})
+
+	schemaURI := pathToURI(filepath.Join(root, "schema.graphqls"))
+	references := func(line, character protocol.UInteger, includeDeclaration bool) []string {
+		locations, err := s.references(nil, &protocol.ReferenceParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: schemaURI},
+				Position:     protocol.Position{Line: line, Character: character},
+			},
+			Context: protocol.ReferenceContext{IncludeDeclaration: includeDeclaration},
+		})
+		if err != nil {
+			t.Fatalf("references error: %v", err)
+		}
+		var got []string
+		for _, loc := range locations {
+			got = append(got, fmt.Sprintf("%s:%d:%d", filepath.Base(uriToPath(loc.URI)), loc.Range.Start.Line, loc.Range.Start.Character))
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	tests := []struct {
+		name               string
+		line, character    protocol.UInteger
+		includeDeclaration bool
+		want               []string
+	}{
+		{"field", 1, 3, true, []string{"list.graphql:1:8", "schema.graphqls:1:2"}},
+		{"argument", 1, 10, false, []string{"list.graphql:1:15"}},
+		{"enum value", 4, 15, false, []string{"list.graphql:1:23", "schema.graphqls:5:66", "schema.graphqls:6:37", "schema.graphqls:6:75"}},
+		{"enum value in an input field default", 4, 20, false, []string{"schema.graphqls:5:37"}},
+		{"field through fragment", 3, 22, false, []string{"row.graphql:0:27"}},
+		{"type", 3, 6, false, []string{"row.graphql:0:16", "schema.graphqls:1:27", "schema.graphqls:6:85"}},
+	}
+	for _, tt := range tests {
+		got := references(tt.line, tt.character, tt.includeDeclaration)
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Fatalf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
 func TestHoverSchemaType(t *testing.T) {
 	s := New()
 	uri := protocol.DocumentUri("file:///tmp/schema.graphql")
@@ -704,6 +2089,60 @@ func TestDefinitionHandlerType(t *testing.T) {
 	}
 }
 
+func TestDefinitionHandlerOperationReferences(t *testing.T) {
+	s := New()
+	queryURI := protocol.DocumentUri("file:///tmp/query.graphql")
+	schemaURI := protocol.DocumentUri("file:///tmp/schema.graphqls")
+	query := "query Users($order: Order) {\n  users(filter: { role: ADMIN }, order: $order) @cached(ttl: 60) {\n    ... on User { name }\n  }\n}\n"
+
+	schema := gqlparser.MustLoadSchema(&ast.Source{
+		Name:  string(schemaURI),
+		Input: "type Query {\n  users(filter: UserFilter, order: Order): [User]\n}\ninput UserFilter { role: Role }\nenum Role { ADMIN MEMBER }\nenum Order { NEWEST }\ntype User { name: String }\ndirective @cached(ttl: Int) on FIELD\n",
+	})
+
+	s.state.mu.Lock()
+	s.state.schema = schema
+	s.state.docs[queryURI] = query
+	s.state.mu.Unlock()
+
+	tests := []struct {
+		name      string
+		line      protocol.UInteger
+		character protocol.UInteger
+		uri       protocol.DocumentUri
+		wantLine  protocol.UInteger
+		wantChar  protocol.UInteger
+	}{
+		{"argument", 1, 9, schemaURI, 1, 8},
+		{"input field", 1, 19, schemaURI, 3, 19},
+		{"enum value", 1, 25, schemaURI, 4, 12},
+		{"variable", 1, 41, queryURI, 0, 12},
+		{"directive", 1, 50, schemaURI, 7, 11},
+		{"directive argument", 1, 57, schemaURI, 7, 18},
+		{"variable type", 0, 21, schemaURI, 5, 5},
+		{"type condition", 2, 12, schemaURI, 6, 5},
+	}
+	for _, tt := range tests {
+		result, err := s.definition(nil, &protocol.DefinitionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: queryURI},
+				Position:     protocol.Position{Line: tt.line, Character: tt.character},
+			},
+		})
+		if err != nil {
+			t.Fatalf("%s: definition error: %v", tt.name, err)
+		}
+		locations, ok := result.([]protocol.Location)
+		if !ok || len(locations) != 1 {
+			t.Fatalf("%s: expected one location, got %#v", tt.name, result)
+		}
+		start := locations[0].Range.Start
+		if locations[0].URI != tt.uri || start.Line != tt.wantLine || start.Character != tt.wantChar {
+			t.Fatalf("%s: expected %s:%d:%d, got %#v", tt.name, tt.uri, tt.wantLine, tt.wantChar, locations[0])
+		}
+	}
+}
+
 func TestDefinitionHandlerSchemaReference(t *testing.T) {
 	s := New()
 	schemaURI := protocol.DocumentUri("file:///tmp/schema.graphql")
@@ -718,132 +2157,622 @@ func TestDefinitionHandlerSchemaReference(t *testing.T) {
 	s.state.docs[schemaURI] = schemaText
 	s.state.mu.Unlock()
 
-	result, err := s.definition(nil, &protocol.DefinitionParams{
+	result, err := s.definition(nil, &protocol.DefinitionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: schemaURI},
+			Position: protocol.Position{
+				Line:      0,
+				Character: 20,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("definition error: %v", err)
+	}
+	locations, ok := result.([]protocol.Location)
+	if !ok || len(locations) == 0 {
+		t.Fatalf("expected locations, got %T", result)
+	}
+	if locations[0].URI != schemaURI {
+		t.Fatalf("expected schema URI %s, got %s", schemaURI, locations[0].URI)
+	}
+}
+
+func TestRenameSchemaType(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	file1 := filepath.Join(root, "schema.graphql")
+	file2 := filepath.Join(root, "more.graphql")
+	text1 := "type Foo {\n  id: ID\n}\n"
+	text2 := "type Query {\n  foo: Foo\n}\n"
+	if err := os.WriteFile(file1, []byte(text1), 0o644); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+	if err := os.WriteFile(file2, []byte(text2), 0o644); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+
+	s.state.mu.Lock()
+	s.state.rootPath = root
+	s.state.schemaPaths = nil
+	s.state.mu.Unlock()
+
+	ctx := &glsp.Context{
+		Notify: func(_ string, _ any) {},
+	}
+	s.loadWorkspaceSchema(ctx)
+
+	uri := pathToURI(file1)
+	edit, err := s.rename(nil, &protocol.RenameParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position: protocol.Position{
+				Line:      0,
+				Character: 5,
+			},
+		},
+		NewName: "Bar",
+	})
+	if err != nil {
+		t.Fatalf("rename error: %v", err)
+	}
+	if edit == nil || edit.Changes == nil {
+		t.Fatalf("expected workspace edit, got %#v", edit)
+	}
+	changes := edit.Changes
+	if len(changes) < 2 {
+		t.Fatalf("expected edits in multiple files, got %#v", changes)
+	}
+	if edits, ok := changes[uri]; !ok || len(edits) == 0 || edits[0].NewText != "Bar" {
+		t.Fatalf("expected rename in %s, got %#v", uri, edits)
+	}
+	otherURI := pathToURI(file2)
+	if edits, ok := changes[otherURI]; !ok || len(edits) == 0 || edits[0].NewText != "Bar" {
+		t.Fatalf("expected rename in %s, got %#v", otherURI, edits)
+	}
+}
+
+func TestRenameSchemaEnumValue(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	file1 := filepath.Join(root, "schema.graphql")
+	file2 := filepath.Join(root, "more.graphql")
+	file3 := filepath.Join(root, "query.graphql")
+	text1 := "enum Color {\n  RED\n  GREEN\n}\n\ninput Input {\n  color: Color = RED\n  colors: [Color] = [GREEN, RED]\n}\n"
+	text2 := "type Query {\n  foo(color: Color = RED, input: Input = { color: RED }): String\n}\n"
+	text3 := "{ foo(color: RED) }\n"
+	if err := os.WriteFile(file1, []byte(text1), 0o644); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+	if err := os.WriteFile(file2, []byte(text2), 0o644); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+	if err := os.WriteFile(file3, []byte(text3), 0o644); err != nil {
+		t.Fatalf("write query: %v", err)
+	}
+
+	s.state.mu.Lock()
+	s.state.rootPath = root
+	s.state.schemaPaths = nil
+	s.state.mu.Unlock()
+
+	ctx := &glsp.Context{
+		Notify: func(_ string, _ any) {},
+	}
+	s.loadWorkspaceSchema(ctx)
+
+	uri := pathToURI(file1)
+	edit, err := s.rename(nil, &protocol.RenameParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position: protocol.Position{
+				Line:      1,
+				Character: 2,
+			},
+		},
+		NewName: "BLUE",
+	})
+	if err != nil {
+		t.Fatalf("rename error: %v", err)
+	}
+	if edit == nil || edit.Changes == nil {
+		t.Fatalf("expected workspace edit, got %#v", edit)
+	}
+	changes := edit.Changes
+	if len(changes) < 2 {
+		t.Fatalf("expected edits in multiple files, got %#v", changes)
+	}
+	// The declaration, the input field default, and the list default.
+	if edits, ok := changes[uri]; !ok || len(edits) != 3 || edits[0].NewText != "BLUE" {
+		t.Fatalf("expected rename in %s, got %#v", uri, edits)
+	}
+	// The argument default and the value inside the input object default.
+	otherURI := pathToURI(file2)
+	if edits, ok := changes[otherURI]; !ok || len(edits) != 2 || edits[0].NewText != "BLUE" {
+		t.Fatalf("expected rename in %s, got %#v", otherURI, edits)
+	}
+	queryURI := pathToURI(file3)
+	if edits, ok := changes[queryURI]; !ok || len(edits) != 1 || edits[0].Range.Start != (protocol.Position{Line: 0, Character: 13}) {
+		t.Fatalf("expected rename in %s, got %#v", queryURI, edits)
+	}
+}
+
+func TestRenameSchemaField(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	files := map[string]string{
+		"schema.graphqls": "interface Node {\n  id: ID!\n}\n\ntype User implements Node {\n  \"The user ID.\"\n  id: ID!\n  name: String\n}\n\ntype Post implements Node { id: ID! }\n\ntype Query { node(id: ID!): Node }\n",
+		"node.graphql":    "query Node($id: ID!) {\n  node(id: $id) {\n    id\n    ... on User { key: id name }\n  }\n}\n",
+		"post.graphql":    "fragment PostRow on Post { id }\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	s.loadWorkspaceSchema(&glsp.Context{Notify: func(string, any) {}})
+
+	rename := func(file string, line, character protocol.UInteger, newName string) (map[string]string, error) {
+		edit, err := s.rename(nil, &protocol.RenameParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: pathToURI(filepath.Join(root, file))},
+				Position:     protocol.Position{Line: line, Character: character},
+			},
+			NewName: newName,
+		})
+		if err != nil || edit == nil {
+			return nil, err
+		}
+		result := make(map[string]string)
+		for uri, edits := range edit.Changes {
+			name := filepath.Base(uriToPath(uri))
+			text := files[name]
+			sort.Slice(edits, func(i, j int) bool {
+				a, b := edits[i].Range.Start, edits[j].Range.Start
+				return a.Line > b.Line || a.Line == b.Line && a.Character > b.Character
+			})
+			for _, e := range edits {
+				text = applyRangeChange(text, e.Range, e.NewText)
+			}
+			result[name] = text
+		}
+		return result, nil
+	}
+
+	got, err := rename("schema.graphqls", 6, 3, "uid")
+	if err != nil {
+		t.Fatalf("rename error: %v", err)
+	}
+	want := map[string]string{
+		"schema.graphqls": "interface Node {\n  uid: ID!\n}\n\ntype User implements Node {\n  \"The user ID.\"\n  uid: ID!\n  name: String\n}\n\ntype Post implements Node { uid: ID! }\n\ntype Query { node(id: ID!): Node }\n",
+		"node.graphql":    "query Node($id: ID!) {\n  node(id: $id) {\n    uid\n    ... on User { key: uid name }\n  }\n}\n",
+		"post.graphql":    "fragment PostRow on Post { uid }\n",
+	}
+	for name, text := range want {
+		if got[name] != text {
+			t.Fatalf("unexpected %s after rename:\n%s", name, got[name])
+		}
+	}
+
+	got, err = rename("node.graphql", 1, 8, "nodeId")
+	if err != nil {
+		t.Fatalf("rename argument error: %v", err)
+	}
+	if got["schema.graphqls"] != strings.Replace(files["schema.graphqls"], "node(id:", "node(nodeId:", 1) ||
+		got["node.graphql"] != strings.Replace(files["node.graphql"], "node(id:", "node(nodeId:", 1) || len(got) != 2 {
+		t.Fatalf("unexpected argument rename: %#v", got)
+	}
+
+	if _, err := rename("schema.graphqls", 1, 3, "name"); err == nil || !strings.Contains(err.Error(), "User already has a field named \"name\"") {
+		t.Fatalf("expected a collision error, got %v", err)
+	}
+	if _, err := rename("schema.graphqls", 1, 3, "1id"); err == nil {
+		t.Fatalf("expected an invalid name error")
+	}
+}
+
+// handle sends a request through the handler table, as the JSON-RPC
+// connection does.
+func handle(t *testing.T, s *Server, method string, params any) (any, error) {
+	t.Helper()
+	raw, err := json.Marshal(params)
+	if err != nil {
+		t.Fatalf("marshal %s params: %v", method, err)
+	}
+	result, validMethod, validParams, err := s.handler.Handle(&glsp.Context{
+		Method: method,
+		Params: raw,
+		Notify: func(string, any) {},
+	})
+	if !validMethod {
+		t.Fatalf("%s: method not found", method)
+	}
+	if !validParams {
+		t.Fatalf("%s: invalid params", method)
+	}
+	return result, err
+}
+
+func TestPrepareRenameHandler(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "schema.graphqls"), []byte("type Query { user: User }\ntype User { id: ID }\n"), 0o644); err != nil {
+		t.Fatalf("write schema: %v", err)
+	}
+	rootURI := pathToURI(root)
+	if _, err := handle(t, s, protocol.MethodInitialize, protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	s.loadWorkspaceSchema(&glsp.Context{Notify: func(string, any) {}})
+
+	schemaURI := pathToURI(filepath.Join(root, "schema.graphqls"))
+	result, err := handle(t, s, protocol.MethodTextDocumentPrepareRename, protocol.PrepareRenameParams{
 		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
 			TextDocument: protocol.TextDocumentIdentifier{URI: schemaURI},
-			Position: protocol.Position{
-				Line:      0,
-				Character: 20,
-			},
+			Position:     protocol.Position{Line: 1, Character: 6},
 		},
 	})
 	if err != nil {
-		t.Fatalf("definition error: %v", err)
+		t.Fatalf("prepareRename error: %v", err)
 	}
-	locations, ok := result.([]protocol.Location)
-	if !ok || len(locations) == 0 {
-		t.Fatalf("expected locations, got %T", result)
+	prepared, ok := result.(protocol.RangeWithPlaceholder)
+	want := protocol.Range{Start: protocol.Position{Line: 1, Character: 5}, End: protocol.Position{Line: 1, Character: 9}}
+	if !ok || prepared.Placeholder != "User" || prepared.Range != want {
+		t.Fatalf("unexpected prepareRename result: %#v", result)
 	}
-	if locations[0].URI != schemaURI {
-		t.Fatalf("expected schema URI %s, got %s", schemaURI, locations[0].URI)
+
+	// The reason a name cannot be renamed reaches the client as the error.
+	_, err = handle(t, s, protocol.MethodTextDocumentPrepareRename, protocol.PrepareRenameParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: schemaURI},
+			Position:     protocol.Position{Line: 1, Character: 18},
+		},
+	})
+	if err == nil || err.Error() != "built-in scalar ID cannot be renamed" {
+		t.Fatalf("expected the built-in scalar reason, got %v", err)
 	}
 }
 
-func TestRenameSchemaType(t *testing.T) {
+func TestRenameExecutableDocuments(t *testing.T) {
 	s := New()
 	root := t.TempDir()
-	file1 := filepath.Join(root, "schema.graphql")
-	file2 := filepath.Join(root, "more.graphql")
-	text1 := "type Foo {\n  id: ID\n}\n"
-	text2 := "type Query {\n  foo: Foo\n}\n"
-	if err := os.WriteFile(file1, []byte(text1), 0o644); err != nil {
-		t.Fatalf("write schema: %v", err)
+	files := map[string]string{
+		"schema.graphqls": "type Query { orders(first: Int): [Order] }\ntype Order { id: ID items(first: Int): [String] }\n",
+		"orders.graphql":  "query Orders($first: Int) {\n  orders(first: $first) { ...Row }\n}\n",
+		"row.graphql":     "fragment Row on Order { id items(first: $first) }\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
 	}
-	if err := os.WriteFile(file2, []byte(text2), 0o644); err != nil {
-		t.Fatalf("write schema: %v", err)
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		t.Fatalf("initialize error: %v", err)
 	}
+	s.loadWorkspaceSchema(&glsp.Context{Notify: func(string, any) {}})
 
-	s.state.mu.Lock()
-	s.state.rootPath = root
-	s.state.schemaPaths = nil
-	s.state.mu.Unlock()
-
-	ctx := &glsp.Context{
-		Notify: func(_ string, _ any) {},
+	position := func(file string, line, character protocol.UInteger) protocol.TextDocumentPositionParams {
+		return protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: pathToURI(filepath.Join(root, file))},
+			Position:     protocol.Position{Line: line, Character: character},
+		}
+	}
+	rename := func(file string, line, character protocol.UInteger, newName string) map[string]string {
+		edit, err := s.rename(nil, &protocol.RenameParams{TextDocumentPositionParams: position(file, line, character), NewName: newName})
+		if err != nil || edit == nil {
+			t.Fatalf("rename to %s: %#v, %v", newName, edit, err)
+		}
+		result := make(map[string]string)
+		for uri, edits := range edit.Changes {
+			name := filepath.Base(uriToPath(uri))
+			text := files[name]
+			for i := len(edits) - 1; i >= 0; i-- {
+				text = applyRangeChange(text, edits[i].Range, edits[i].NewText)
+			}
+			result[name] = text
+		}
+		return result
 	}
-	s.loadWorkspaceSchema(ctx)
 
-	uri := pathToURI(file1)
-	edit, err := s.rename(nil, &protocol.RenameParams{
-		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
-			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
-			Position: protocol.Position{
-				Line:      0,
-				Character: 5,
-			},
-		},
-		NewName: "Bar",
-	})
+	result, err := s.prepareRename(nil, &protocol.PrepareRenameParams{TextDocumentPositionParams: position("orders.graphql", 1, 30)})
 	if err != nil {
-		t.Fatalf("rename error: %v", err)
+		t.Fatalf("prepareRename error: %v", err)
 	}
-	if edit == nil || edit.Changes == nil {
-		t.Fatalf("expected workspace edit, got %#v", edit)
+	prepared, ok := result.(protocol.RangeWithPlaceholder)
+	if !ok || prepared.Placeholder != "Row" || prepared.Range.Start != (protocol.Position{Line: 1, Character: 29}) || prepared.Range.End.Character != 32 {
+		t.Fatalf("unexpected prepareRename result: %#v", result)
 	}
-	changes := edit.Changes
-	if len(changes) < 2 {
-		t.Fatalf("expected edits in multiple files, got %#v", changes)
+
+	got := rename("orders.graphql", 1, 30, "OrderRow")
+	if got["orders.graphql"] != strings.Replace(files["orders.graphql"], "...Row", "...OrderRow", 1) ||
+		got["row.graphql"] != strings.Replace(files["row.graphql"], "fragment Row", "fragment OrderRow", 1) {
+		t.Fatalf("unexpected fragment rename: %#v", got)
 	}
-	if edits, ok := changes[uri]; !ok || len(edits) == 0 || edits[0].NewText != "Bar" {
-		t.Fatalf("expected rename in %s, got %#v", uri, edits)
+
+	got = rename("orders.graphql", 1, 18, "$count")
+	if got["orders.graphql"] != "query Orders($count: Int) {\n  orders(first: $count) { ...Row }\n}\n" || len(got) != 1 {
+		t.Fatalf("unexpected variable rename: %#v", got)
 	}
-	otherURI := pathToURI(file2)
-	if edits, ok := changes[otherURI]; !ok || len(edits) == 0 || edits[0].NewText != "Bar" {
-		t.Fatalf("expected rename in %s, got %#v", otherURI, edits)
+
+	got = rename("orders.graphql", 0, 8, "ListOrders")
+	if got["orders.graphql"] != strings.Replace(files["orders.graphql"], "query Orders", "query ListOrders", 1) {
+		t.Fatalf("unexpected operation rename: %#v", got)
+	}
+
+	result, err = s.prepareRename(nil, &protocol.PrepareRenameParams{TextDocumentPositionParams: position("orders.graphql", 1, 3)})
+	if prepared, ok := result.(protocol.RangeWithPlaceholder); err != nil || !ok || prepared.Placeholder != "orders" {
+		t.Fatalf("expected the field to be renamable, got %#v, %v", result, err)
+	}
+	if _, err := s.prepareRename(nil, &protocol.PrepareRenameParams{TextDocumentPositionParams: position("row.graphql", 0, 42)}); err == nil {
+		t.Fatalf("expected an error for a variable used in a fragment")
+	}
+	if _, err := s.prepareRename(nil, &protocol.PrepareRenameParams{TextDocumentPositionParams: position("orders.graphql", 0, 26)}); err == nil {
+		t.Fatalf("expected an error where there is nothing to rename")
 	}
 }
 
-func TestRenameSchemaEnumValue(t *testing.T) {
+func TestRenameValidation(t *testing.T) {
 	s := New()
 	root := t.TempDir()
-	file1 := filepath.Join(root, "schema.graphql")
-	file2 := filepath.Join(root, "more.graphql")
-	text1 := "enum Color {\n  RED\n  GREEN\n}\n\ninput Input {\n  color: Color = RED\n}\n"
-	text2 := "type Query {\n  foo(color: Color = RED): String\n}\n"
-	if err := os.WriteFile(file1, []byte(text1), 0o644); err != nil {
-		t.Fatalf("write schema: %v", err)
+	files := map[string]string{
+		"schema.graphqls": "type Query { user: User status: Status }\ntype User { id: ID name: String }\ntype Account { id: ID }\nenum Status { ACTIVE INACTIVE }\n",
+		"user.graphql":    "query User($id: ID) { user { id } }\n",
 	}
-	if err := os.WriteFile(file2, []byte(text2), 0o644); err != nil {
-		t.Fatalf("write schema: %v", err)
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		t.Fatalf("initialize error: %v", err)
 	}
+	s.loadWorkspaceSchema(&glsp.Context{Notify: func(string, any) {}})
 
-	s.state.mu.Lock()
-	s.state.rootPath = root
-	s.state.schemaPaths = nil
-	s.state.mu.Unlock()
+	rename := func(file string, line, character protocol.UInteger, newName string) (*protocol.WorkspaceEdit, error) {
+		return s.rename(nil, &protocol.RenameParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: pathToURI(filepath.Join(root, file))},
+				Position:     protocol.Position{Line: line, Character: character},
+			},
+			NewName: newName,
+		})
+	}
+
+	tests := []struct {
+		name      string
+		file      string
+		line      protocol.UInteger
+		character protocol.UInteger
+		newName   string
+		wantErr   string
+	}{
+		{"type collision", "schema.graphqls", 1, 6, "Account", "type Account already exists"},
+		{"invalid name", "schema.graphqls", 1, 6, "2User", `"2User" is not a valid GraphQL name`},
+		{"empty name", "schema.graphqls", 1, 6, "", "the new name is empty"},
+		{"reserved name", "schema.graphqls", 1, 20, "__id", `"__id" is reserved`},
+		{"enum collision", "schema.graphqls", 3, 15, "INACTIVE", "enum Status already has a value named INACTIVE"},
+		{"enum literal", "schema.graphqls", 3, 15, "null", `"null" cannot be used as an enum value`},
+		{"built-in scalar", "schema.graphqls", 1, 17, "Identifier", "built-in scalar ID cannot be renamed"},
+		{"invalid variable", "user.graphql", 0, 12, "$user-id", `"user-id" is not a valid GraphQL name`},
+		{"nothing to rename", "user.graphql", 0, 20, "Other", "there is nothing to rename"},
+	}
+	for _, tt := range tests {
+		edit, err := rename(tt.file, tt.line, tt.character, tt.newName)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Fatalf("%s: expected error %q, got %#v, %v", tt.name, tt.wantErr, edit, err)
+		}
+	}
 
-	ctx := &glsp.Context{
-		Notify: func(_ string, _ any) {},
+	if edit, err := rename("schema.graphqls", 1, 6, "User"); err != nil || edit != nil {
+		t.Fatalf("expected no edit when the name is unchanged, got %#v, %v", edit, err)
 	}
-	s.loadWorkspaceSchema(ctx)
+	if edit, err := rename("schema.graphqls", 1, 6, "Person"); err != nil || edit == nil {
+		t.Fatalf("expected a valid rename to succeed, got %#v, %v", edit, err)
+	}
+}
 
-	uri := pathToURI(file1)
-	edit, err := s.rename(nil, &protocol.RenameParams{
-		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
-			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
-			Position: protocol.Position{
-				Line:      1,
-				Character: 2,
+func TestRenameDirective(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	files := map[string]string{
+		"schema.graphqls": "directive @auth(role: String) on FIELD_DEFINITION | FIELD\ndirective @cached on FIELD\n\ntype Query {\n  me: String @auth(role: \"user\")\n  old: String @deprecated\n}\n",
+		"me.graphql":      "query Me { me @auth @cached }\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	s.loadWorkspaceSchema(&glsp.Context{Notify: func(string, any) {}})
+
+	rename := func(file string, line, character protocol.UInteger, newName string) (*protocol.WorkspaceEdit, error) {
+		return s.rename(nil, &protocol.RenameParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: pathToURI(filepath.Join(root, file))},
+				Position:     protocol.Position{Line: line, Character: character},
 			},
-		},
-		NewName: "BLUE",
-	})
-	if err != nil {
-		t.Fatalf("rename error: %v", err)
+			NewName: newName,
+		})
+	}
+	apply := func(edit *protocol.WorkspaceEdit) map[string]string {
+		result := make(map[string]string)
+		for uri, edits := range edit.Changes {
+			name := filepath.Base(uriToPath(uri))
+			text := files[name]
+			sort.Slice(edits, func(i, j int) bool {
+				return edits[i].Range.Start.Line > edits[j].Range.Start.Line ||
+					edits[i].Range.Start.Line == edits[j].Range.Start.Line && edits[i].Range.Start.Character > edits[j].Range.Start.Character
+			})
+			for _, e := range edits {
+				text = applyRangeChange(text, e.Range, e.NewText)
+			}
+			result[name] = text
+		}
+		return result
+	}
+
+	want := map[string]string{
+		"schema.graphqls": strings.ReplaceAll(files["schema.graphqls"], "@auth", "@authorize"),
+		"me.graphql":      strings.ReplaceAll(files["me.graphql"], "@auth", "@authorize"),
+	}
+	for _, tt := range []struct {
+		name      string
+		file      string
+		line      protocol.UInteger
+		character protocol.UInteger
+		newName   string
+	}{
+		{"definition", "schema.graphqls", 0, 12, "authorize"},
+		{"schema usage", "schema.graphqls", 4, 15, "@authorize"},
+		{"operation usage", "me.graphql", 0, 16, "authorize"},
+	} {
+		edit, err := rename(tt.file, tt.line, tt.character, tt.newName)
+		if err != nil || edit == nil {
+			t.Fatalf("%s: rename error: %#v, %v", tt.name, edit, err)
+		}
+		if got := apply(edit); got["schema.graphqls"] != want["schema.graphqls"] || got["me.graphql"] != want["me.graphql"] {
+			t.Fatalf("%s: unexpected rename: %#v", tt.name, got)
+		}
 	}
-	if edit == nil || edit.Changes == nil {
-		t.Fatalf("expected workspace edit, got %#v", edit)
+
+	if _, err := rename("schema.graphqls", 5, 16, "obsolete"); err == nil || !strings.Contains(err.Error(), "built-in directive @deprecated cannot be renamed") {
+		t.Fatalf("expected an error for a built-in directive, got %v", err)
 	}
-	changes := edit.Changes
-	if len(changes) < 2 {
-		t.Fatalf("expected edits in multiple files, got %#v", changes)
+	if _, err := rename("schema.graphqls", 0, 12, "cached"); err == nil || !strings.Contains(err.Error(), "directive @cached already exists") {
+		t.Fatalf("expected an error for an existing directive, got %v", err)
 	}
-	if edits, ok := changes[uri]; !ok || len(edits) == 0 || edits[0].NewText != "BLUE" {
-		t.Fatalf("expected rename in %s, got %#v", uri, edits)
+}
+
+func TestImplementation(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	files := map[string]string{
+		"schema.graphqls": "interface Node {\n  id: ID!\n}\n\ntype User implements Node {\n  \"The user ID.\"\n  id: ID!\n}\n\ntype Post { id: ID! }\n\nunion SearchResult = User | Post\n\ntype Query { node: Node search: [SearchResult] }\n",
+		"post.graphqls":   "extend type Post implements Node\n",
+		"node.graphql":    "query Node {\n  node { id }\n  search { ... on Node { id } }\n}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
 	}
-	otherURI := pathToURI(file2)
-	if edits, ok := changes[otherURI]; !ok || len(edits) == 0 || edits[0].NewText != "BLUE" {
-		t.Fatalf("expected rename in %s, got %#v", otherURI, edits)
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	s.loadWorkspaceSchema(&glsp.Context{Notify: func(string, any) {}})
+
+	implementation := func(file string, line, character protocol.UInteger) []string {
+		result, err := s.implementation(nil, &protocol.ImplementationParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: pathToURI(filepath.Join(root, file))},
+				Position:     protocol.Position{Line: line, Character: character},
+			},
+		})
+		if err != nil {
+			t.Fatalf("implementation error: %v", err)
+		}
+		locations, _ := result.([]protocol.Location)
+		got := make([]string, 0, len(locations))
+		for _, loc := range locations {
+			got = append(got, fmt.Sprintf("%s:%d:%d", filepath.Base(uriToPath(loc.URI)), loc.Range.Start.Line, loc.Range.Start.Character))
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	tests := []struct {
+		name      string
+		file      string
+		line      protocol.UInteger
+		character protocol.UInteger
+		want      []string
+	}{
+		{"interface", "schema.graphqls", 0, 11, []string{"schema.graphqls:4:5", "schema.graphqls:9:5"}},
+		{"interface reference", "schema.graphqls", 4, 23, []string{"schema.graphqls:4:5", "schema.graphqls:9:5"}},
+		{"interface field", "schema.graphqls", 1, 2, []string{"schema.graphqls:6:2", "schema.graphqls:9:12"}},
+		{"union", "schema.graphqls", 11, 8, []string{"schema.graphqls:4:5", "schema.graphqls:9:5"}},
+		{"object type", "schema.graphqls", 4, 6, []string{}},
+		{"operation field", "node.graphql", 1, 9, []string{"schema.graphqls:6:2", "schema.graphqls:9:12"}},
+		{"type condition", "node.graphql", 2, 18, []string{"schema.graphqls:4:5", "schema.graphqls:9:5"}},
+	}
+	for _, tt := range tests {
+		if got := implementation(tt.file, tt.line, tt.character); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Fatalf("%s: unexpected implementations %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestTypeDefinition(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	files := map[string]string{
+		"schema.graphqls": "type Query {\n  viewer: User\n  users(filter: UserFilter, role: Role): [User!]!\n}\n\ntype User { name: String role: Role }\n\ninput UserFilter { role: Role }\n\nenum Role { ADMIN MEMBER }\n",
+		"users.graphql":   "query Users($filter: UserFilter!) {\n  viewer { name }\n  users(filter: $filter, role: ADMIN) { role }\n}\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	s.loadWorkspaceSchema(&glsp.Context{Notify: func(string, any) {}})
+
+	typeDefinition := func(file string, line, character protocol.UInteger) string {
+		result, err := s.typeDefinition(nil, &protocol.TypeDefinitionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: pathToURI(filepath.Join(root, file))},
+				Position:     protocol.Position{Line: line, Character: character},
+			},
+		})
+		if err != nil {
+			t.Fatalf("typeDefinition error: %v", err)
+		}
+		locations, _ := result.([]protocol.Location)
+		if len(locations) != 1 {
+			return fmt.Sprintf("%#v", result)
+		}
+		loc := locations[0]
+		return fmt.Sprintf("%s:%d:%d", filepath.Base(uriToPath(loc.URI)), loc.Range.Start.Line, loc.Range.Start.Character)
+	}
+
+	tests := []struct {
+		name      string
+		file      string
+		line      protocol.UInteger
+		character protocol.UInteger
+		want      string
+	}{
+		{"field", "users.graphql", 1, 3, "schema.graphqls:5:5"},
+		{"list field", "users.graphql", 2, 3, "schema.graphqls:5:5"},
+		{"enum field", "users.graphql", 2, 41, "schema.graphqls:9:5"},
+		{"variable", "users.graphql", 2, 17, "schema.graphqls:7:6"},
+		{"variable definition", "users.graphql", 0, 14, "schema.graphqls:7:6"},
+		{"argument", "users.graphql", 2, 26, "schema.graphqls:9:5"},
+		{"enum value", "users.graphql", 2, 33, "schema.graphqls:9:5"},
+		{"schema field", "schema.graphqls", 2, 3, "schema.graphqls:5:5"},
+		{"schema argument", "schema.graphqls", 2, 29, "schema.graphqls:9:5"},
+	}
+	for _, tt := range tests {
+		if got := typeDefinition(tt.file, tt.line, tt.character); got != tt.want {
+			t.Fatalf("%s: unexpected type definition %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	if got := typeDefinition("users.graphql", 1, 11); got != "<nil>" {
+		t.Fatalf("expected no type definition for a scalar field, got %s", got)
 	}
 }
 
@@ -895,6 +2824,203 @@ func TestCompletionFields(t *testing.T) {
 	}
 }
 
+func TestCompletionArguments(t *testing.T) {
+	s := New()
+	queryURI := protocol.DocumentUri("file:///tmp/query.graphql")
+	schema := gqlparser.MustLoadSchema(&ast.Source{
+		Input: "type Query { orders(first: Int!, status: Status, filter: OrderFilter, archived: Boolean = false): [Order] }\n" +
+			"type Order { id: ID }\nenum Status { OPEN CLOSED }\ninput OrderFilter { status: Status! since: String }\n",
+	})
+	s.state.mu.Lock()
+	s.state.schema = schema
+	s.state.mu.Unlock()
+
+	const head = "query Q($n: Int!, $m: Int, $s: Status) { "
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{head + "orders(|) { id } }", "first, status, filter, archived"},
+		{head + "orders(first: 1, |) { id } }", "status, filter, archived"},
+		{head + "orders(first: 1, st|) { id } }", "status, filter, archived"},
+		{head + "orders(status: |) { id } }", "OPEN, CLOSED, null, $s"},
+		{head + "orders(first: |) { id } }", "$n"},
+		{head + "orders(first: 1, archived: |) { id } }", "true, false, null"},
+		{head + "orders(first: 1 filter: |) { id } }", "{ }, null"},
+		{head + "orders(first: 1) @include(if: |) { id } }", "true, false"},
+		{head + "orders(first: 1) { id | } }", "id"},
+	}
+	for _, tt := range tests {
+		if got := completionLabels(completeAt(t, s, queryURI, tt.query)); got != tt.want {
+			t.Fatalf("completion in %q: got %s, want %s", tt.query, got, tt.want)
+		}
+	}
+
+	item, _ := findCompletionItem(completeAt(t, s, queryURI, head+"orders(first: 1, filter: |) { id } }"), "{ }")
+	if item.InsertText == nil || *item.InsertText != "{ status: ${1} }" {
+		t.Fatalf("expected an input object snippet with required fields, got %#v", item.InsertText)
+	}
+	item, _ = findCompletionItem(completeAt(t, s, queryURI, head+"orders(first: $|) { id } }"), "$n")
+	edit, ok := item.TextEdit.(protocol.TextEdit)
+	if !ok || edit.NewText != "$n" || edit.Range.Start.Character != 55 || edit.Range.End.Character != 56 {
+		t.Fatalf("expected the variable to replace the typed $, got %#v", item.TextEdit)
+	}
+}
+
+func TestCompletionInputObjectFields(t *testing.T) {
+	s := New()
+	queryURI := protocol.DocumentUri("file:///tmp/query.graphql")
+	schema := gqlparser.MustLoadSchema(&ast.Source{
+		Input: "type Query { order: Order }\ntype Mutation { createOrder(input: CreateOrderInput!): Order }\ntype Order { id: ID }\n" +
+			"input CreateOrderInput {\n  \"Who places the order.\"\n  customer: ID!\n  items: [ItemInput!]!\n  note: String\n  status: Status = OPEN\n}\n" +
+			"input ItemInput { sku: String! quantity: Int = 1 }\nenum Status { OPEN CLOSED }\n",
+	})
+	s.state.mu.Lock()
+	s.state.schema = schema
+	s.state.mu.Unlock()
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"mutation { createOrder(input: { | }) { id } }", "customer, items, note, status"},
+		{"mutation { createOrder(input: { customer: \"1\", | }) { id } }", "items, note, status"},
+		{"mutation { createOrder(input: { items: [{ sku: \"a\" }, { | }] }) { id } }", "sku, quantity"},
+		{"mutation { createOrder(input: { status: | }) { id } }", "OPEN, CLOSED, null"},
+		{"mutation { createOrder(input: { items: [|] }) { id } }", "{ }"},
+		{"mutation { createOrder(input: { customer: \"1\" }) { id | } }", "id"},
+	}
+	for _, tt := range tests {
+		if got := completionLabels(completeAt(t, s, queryURI, tt.query)); got != tt.want {
+			t.Fatalf("completion in %q: got %s, want %s", tt.query, got, tt.want)
+		}
+	}
+
+	items := completeAt(t, s, queryURI, "mutation { createOrder(input: { | }) { id } }")
+	customer, _ := findCompletionItem(items, "customer")
+	status, _ := findCompletionItem(items, "status")
+	if customer.SortText == nil || status.SortText == nil || *customer.SortText >= *status.SortText {
+		t.Fatalf("expected required fields to sort first, got %v and %v", customer.SortText, status.SortText)
+	}
+	if status.Detail == nil || *status.Detail != "Status = OPEN" {
+		t.Fatalf("expected the default value in the detail, got %v", status.Detail)
+	}
+	if doc, ok := customer.Documentation.(protocol.MarkupContent); !ok || doc.Value != "Who places the order." {
+		t.Fatalf("expected the field description, got %#v", customer.Documentation)
+	}
+}
+
+func TestCompletionIncompleteDocument(t *testing.T) {
+	s := New()
+	queryURI := protocol.DocumentUri("file:///tmp/query.graphql")
+	schema := gqlparser.MustLoadSchema(&ast.Source{
+		Input: "type Query { user(id: ID): User node: Node }\ntype Mutation { rename(name: String): User }\n" +
+			"interface Node { id: ID }\ntype User implements Node { id: ID name: String friends(first: Int): [User] }\n",
+	})
+	s.state.mu.Lock()
+	s.state.schema = schema
+	s.state.mu.Unlock()
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"{ user { na|", "id, name, friends"},
+		{"{ user {|", "id, name, friends"},
+		{"query Q($id: ID) {\n  user(id: $id) @include(if: true) {\n    friends(first: 2) {\n      |", "id, name, friends"},
+		{"{ node { ... on User { friends { |", "id, name, friends"},
+		{"{ node { id ... { |", "id"},
+		{"mutation { rename(name: \"x\") { |", "id, name, friends"},
+		{"fragment F on User { id }\nquery { user { friends { id } } |", "user, node, __schema, __type"},
+		{"{ user(id: |", "null"},
+		{"{ user(|", "id"},
+	}
+	for _, tt := range tests {
+		if got := completionLabels(completeAt(t, s, queryURI, tt.query)); got != tt.want {
+			t.Fatalf("completion in %q: got %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestCompletionVariables(t *testing.T) {
+	s := New()
+	queryURI := protocol.DocumentUri("file:///tmp/query.graphql")
+	schema := gqlparser.MustLoadSchema(&ast.Source{
+		Input: "type Query { user(id: ID, role: Role): User users(filter: UserFilter): [User] }\n" +
+			"type User { id: ID }\nenum Role { ADMIN MEMBER }\ninput UserFilter { role: Role }\n",
+	})
+	s.state.mu.Lock()
+	s.state.schema = schema
+	s.state.mu.Unlock()
+
+	const head = "query Q($id: ID!, $name: String, $role: Role) "
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{head + "{ user(id: $|) { id } }", "$id"},
+		{head + "{ user(id: $i|) { id } }", "$id"},
+		{head + "{\n  user(role: $|", "$role"},
+		{head + "{\n  user(id: 1) { id }\n  user(role: |", "$role, ADMIN, MEMBER, null"},
+		{"query Q($id: |) { user { id } }", "Boolean, Float, ID, Int, Role, String, UserFilter"},
+		{"query Q($id: ID, $ids: [|", "Boolean, Float, ID, Int, Role, String, UserFilter"},
+		{"query ($filter: User|) { users { id } }", "Boolean, Float, ID, Int, Role, String, UserFilter"},
+		{"query Q($id: ID = |) { user { id } }", ""},
+	}
+	for _, tt := range tests {
+		labels := strings.Split(completionLabels(completeAt(t, s, queryURI, tt.query)), ", ")
+		sort.Strings(labels)
+		if got := strings.Join(labels, ", "); got != tt.want {
+			t.Fatalf("completion in %q: got %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestCompletionFragmentSpreads(t *testing.T) {
+	s := New()
+	root := t.TempDir()
+	files := map[string]string{
+		"schema.graphqls":   "interface Node { id: ID }\ntype User implements Node { id: ID name: String }\ntype Post implements Node { id: ID }\nunion Result = User | Post\ntype Query { user: User post: Post node: Node search: [Result] }\n",
+		"fragments.graphql": "fragment UserParts on User { name }\nfragment NodeParts on Node { id }\nfragment PostParts on Post { id }\nfragment ResultParts on Result { __typename }\n",
+		"query.graphql":     "{ user { id } }\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		t.Fatalf("initialize error: %v", err)
+	}
+	s.loadWorkspaceSchema(&glsp.Context{Notify: func(string, any) {}})
+	queryURI := pathToURI(filepath.Join(root, "query.graphql"))
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"{ user { ...| } }", "NodeParts, ResultParts, UserParts, on"},
+		{"{ post { id ... | } }", "NodeParts, PostParts, ResultParts, on"},
+		{"{ node { ...| } }", "NodeParts, PostParts, ResultParts, UserParts, on"},
+		{"{ search { ...| } }", "NodeParts, PostParts, ResultParts, UserParts, on"},
+		{"{ user { ...Lo| } } fragment Local on User { id }", "Local, NodeParts, ResultParts, UserParts, on"},
+		{"fragment Own on User { ...O| }", "NodeParts, ResultParts, UserParts, on"},
+	}
+	for _, tt := range tests {
+		if got := completionLabels(completeAt(t, s, queryURI, tt.query)); got != tt.want {
+			t.Fatalf("completion in %q: got %s, want %s", tt.query, got, tt.want)
+		}
+	}
+
+	item, _ := findCompletionItem(completeAt(t, s, queryURI, "{ user { ...| } }"), "on")
+	if item.InsertText == nil || *item.InsertText != "on ${1:User} { $0 }" {
+		t.Fatalf("expected an inline fragment snippet, got %#v", item.InsertText)
+	}
+}
+
 func TestCompletionDirectives(t *testing.T) {
 	s := New()
 	queryURI := protocol.DocumentUri("file:///tmp/query.graphql")
@@ -1123,6 +3249,32 @@ func completionLabels(items []protocol.CompletionItem) string {
 	return strings.Join(labels, ", ")
 }
 
+// completeAt stores query, without its `|`, as the text of uri and returns
+// the completion items at the `|`.
+func completeAt(t *testing.T, s *Server, uri protocol.DocumentUri, query string) []protocol.CompletionItem {
+	t.Helper()
+	before, _, ok := strings.Cut(query, "|")
+	if !ok {
+		t.Fatalf("no cursor in %q", query)
+	}
+	line := strings.Count(before, "\n")
+	character := len(utf16.Encode([]rune(before[strings.LastIndex(before, "\n")+1:])))
+	s.state.mu.Lock()
+	s.state.docs[uri] = strings.Replace(query, "|", "", 1)
+	s.state.mu.Unlock()
+	result, err := s.completion(nil, &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     protocol.Position{Line: protocol.UInteger(line), Character: protocol.UInteger(character)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("completion error: %v", err)
+	}
+	items, _ := result.([]protocol.CompletionItem)
+	return items
+}
+
 func findCompletionItem(items []protocol.CompletionItem, label string) (protocol.CompletionItem, bool) {
 	for _, item := range items {
 		if item.Label == label {
@@ -1131,3 +3283,67 @@ func findCompletionItem(items []protocol.CompletionItem, label string) (protocol
 	}
 	return protocol.CompletionItem{}, false
 }
+
+// BenchmarkReloadAfterDocumentChange compares a reload from scratch, which
+// walks, reads, and parses the whole workspace, with the reload that follows
+// typing in one document of a warm workspace.
+func BenchmarkReloadAfterDocumentChange(b *testing.B) {
+	root := b.TempDir()
+	var query strings.Builder
+	query.WriteString("type Query {\n")
+	for i := range 300 {
+		query.WriteString(fmt.Sprintf("  type%d: Type%d\n", i, i))
+		schema := fmt.Sprintf("type Type%d {\n  id: ID!\n  name: String\n  next: Type%d\n}\n", i, (i+1)%300)
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("type%d.graphqls", i)), []byte(schema), 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	query.WriteString("}\n")
+	if err := os.WriteFile(filepath.Join(root, "query.graphqls"), []byte(query.String()), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	for i := range 1200 {
+		doc := fmt.Sprintf("fragment F%d on Type%d { id name next { id } }\n", i, i%300)
+		if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("doc%d.graphql", i)), []byte(doc), 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	s := New()
+	rootURI := pathToURI(root)
+	if _, err := s.initialize(nil, &protocol.InitializeParams{RootURI: &rootURI}); err != nil {
+		b.Fatal(err)
+	}
+	ctx := &glsp.Context{Notify: func(string, any) {}}
+	uri := pathToURI(filepath.Join(root, "doc0.graphql"))
+	if err := s.didOpen(ctx, &protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, LanguageID: "graphql", Version: 1, Text: "fragment F0 on Type0 { id }"},
+	}); err != nil {
+		b.Fatal(err)
+	}
+	// Reload the way a scheduled didChange run does, without the debounce.
+	change := func(version int) {
+		s.state.mu.Lock()
+		s.state.docs[uri] = fmt.Sprintf("fragment F0 on Type0 { id } # %d", version)
+		s.state.versions[uri] = protocol.Integer(version)
+		s.state.mu.Unlock()
+		s.refreshChangedDocument(context.Background(), ctx, uri)
+	}
+
+	b.Run("full", func(b *testing.B) {
+		version := 1
+		for b.Loop() {
+			s.state.index = newSourceIndex()
+			s.state.schemaBuilt = false
+			version++
+			change(version)
+		}
+	})
+	b.Run("incremental", func(b *testing.B) {
+		version := 1
+		for b.Loop() {
+			version++
+			change(version)
+		}
+	})
+}
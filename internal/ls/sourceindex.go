@@ -0,0 +1,204 @@
+package ls
+
+import (
+	"hash/maphash"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+// sourceIndex caches workspace listings and the content and parse results of
+// sources, so a reload triggered by typing rereads and reparses only what
+// changed. Listings are kept until invalidateScans; file contents until the
+// file's size or modification time changes.
+type sourceIndex struct {
+	mu      sync.Mutex
+	seed    maphash.Seed
+	scans   map[string][]string
+	entries map[protocol.DocumentUri]*indexedSource
+}
+
+type indexedSource struct {
+	// Disk content, valid while size and modTime match the file.
+	modTime time.Time
+	size    int64
+	text    string
+	read    bool
+
+	// Parse results of the content with hash.
+	hash                uint64
+	schema              *ast.SchemaDocument
+	schemaErr           error
+	schemaParsed        bool
+	query               *ast.QueryDocument
+	queryErr            error
+	queryParsed         bool
+	introspection       *introspectionDocument
+	introspectionErr    error
+	introspectionParsed bool
+}
+
+func newSourceIndex() *sourceIndex {
+	return &sourceIndex{
+		seed:    maphash.MakeSeed(),
+		scans:   make(map[string][]string),
+		entries: make(map[protocol.DocumentUri]*indexedSource),
+	}
+}
+
+// scan returns the cached result of list for key, calling it on a miss.
+func (x *sourceIndex) scan(key string, list func() []string) []string {
+	x.mu.Lock()
+	paths, ok := x.scans[key]
+	x.mu.Unlock()
+	if ok {
+		return paths
+	}
+	paths = list()
+	x.mu.Lock()
+	x.scans[key] = paths
+	x.mu.Unlock()
+	return paths
+}
+
+// invalidateScans drops the cached listings so the next reload walks the
+// workspace again.
+func (x *sourceIndex) invalidateScans() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	clear(x.scans)
+}
+
+// forget drops everything cached for uri.
+func (x *sourceIndex) forget(uri protocol.DocumentUri) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	delete(x.entries, uri)
+}
+
+// readFile returns the content of path, reading it only when its size or
+// modification time changed since the last read.
+func (x *sourceIndex) readFile(uri protocol.DocumentUri, path string) (string, bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return "", false
+	}
+	x.mu.Lock()
+	entry := x.entries[uri]
+	if entry != nil && entry.read && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) {
+		text := entry.text
+		x.mu.Unlock()
+		return text, true
+	}
+	x.mu.Unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	text := string(data)
+	x.mu.Lock()
+	entry = x.entryLocked(uri, text)
+	entry.modTime = info.ModTime()
+	entry.size = info.Size()
+	entry.text = text
+	entry.read = true
+	x.mu.Unlock()
+	return text, true
+}
+
+// entryLocked returns the entry of uri, resetting its parse results when
+// text hashes differently from what they were computed for. It must be
+// called with x.mu held.
+func (x *sourceIndex) entryLocked(uri protocol.DocumentUri, text string) *indexedSource {
+	hash := maphash.String(x.seed, text)
+	entry := x.entries[uri]
+	if entry == nil {
+		entry = &indexedSource{}
+		x.entries[uri] = entry
+	}
+	if entry.hash != hash {
+		*entry = indexedSource{
+			modTime: entry.modTime,
+			size:    entry.size,
+			text:    entry.text,
+			read:    entry.read,
+			hash:    hash,
+		}
+	}
+	return entry
+}
+
+func (x *sourceIndex) schemaDocument(source *ast.Source) (*ast.SchemaDocument, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	entry := x.entryLocked(protocol.DocumentUri(source.Name), source.Input)
+	if !entry.schemaParsed {
+		entry.schema, entry.schemaErr = parser.ParseSchema(source)
+		entry.schemaParsed = true
+	}
+	return entry.schema, entry.schemaErr
+}
+
+func (x *sourceIndex) queryDocument(source *ast.Source) (*ast.QueryDocument, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	entry := x.entryLocked(protocol.DocumentUri(source.Name), source.Input)
+	if !entry.queryParsed {
+		entry.query, entry.queryErr = parser.ParseQuery(source)
+		entry.queryParsed = true
+	}
+	return entry.query, entry.queryErr
+}
+
+func (x *sourceIndex) introspectionDocument(uri protocol.DocumentUri, text string) (*introspectionDocument, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	entry := x.entryLocked(uri, text)
+	if !entry.introspectionParsed {
+		entry.introspection, entry.introspectionErr = parseIntrospection(uri, text)
+		entry.introspectionParsed = true
+	}
+	return entry.introspection, entry.introspectionErr
+}
+
+// schemaKey identifies a list of schema sources by name and content.
+func (x *sourceIndex) schemaKey(sources []*ast.Source) uint64 {
+	var h maphash.Hash
+	h.SetSeed(x.seed)
+	for _, source := range sources {
+		h.WriteString(source.Name)
+		h.WriteByte(0)
+		h.WriteString(source.Input)
+		h.WriteByte(0)
+	}
+	return h.Sum64()
+}
+
+// mergeSchemaDocuments merges docs into a new document. Schema validation
+// appends extension fields to the definitions it is given, so definitions are
+// copied and their lists clipped to keep the cached documents untouched.
+func mergeSchemaDocuments(docs ...*ast.SchemaDocument) *ast.SchemaDocument {
+	merged := &ast.SchemaDocument{}
+	for _, doc := range docs {
+		merged.Schema = append(merged.Schema, doc.Schema...)
+		merged.SchemaExtension = append(merged.SchemaExtension, doc.SchemaExtension...)
+		merged.Directives = append(merged.Directives, doc.Directives...)
+		merged.Extensions = append(merged.Extensions, doc.Extensions...)
+		for _, def := range doc.Definitions {
+			clone := *def
+			clone.Directives = slices.Clip(clone.Directives)
+			clone.Interfaces = slices.Clip(clone.Interfaces)
+			clone.Fields = slices.Clip(clone.Fields)
+			clone.Types = slices.Clip(clone.Types)
+			clone.EnumValues = slices.Clip(clone.EnumValues)
+			merged.Definitions = append(merged.Definitions, &clone)
+		}
+	}
+	return merged
+}
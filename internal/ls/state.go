@@ -2,7 +2,9 @@ package ls
 
 import (
 	"sync"
+	"time"
 
+	"github.com/tliron/glsp"
 	protocol "github.com/tliron/glsp/protocol_3_16"
 	"github.com/vektah/gqlparser/v2/ast"
 )
@@ -10,19 +12,83 @@ import (
 type State struct {
 	mu                sync.Mutex
 	docs              map[protocol.DocumentUri]string
+	versions          map[protocol.DocumentUri]protocol.Integer
 	queryDiagnostics  map[protocol.DocumentUri][]protocol.Diagnostic
+	queryVersions     map[protocol.DocumentUri]protocol.Integer
 	schemaDiagnostics map[protocol.DocumentUri][]protocol.Diagnostic
-	schemaPaths       []string
 	rootPath          string
-	schema            *ast.Schema
-	schemaURIs        map[protocol.DocumentUri]struct{}
+	configPath        string
+	watchFiles        bool
+	printWidth        int
+	introspection     map[protocol.DocumentUri]*introspectionDocument
+	// endpointFetches records when each schema endpoint was last fetched.
+	endpointFetches map[string]time.Time
+	// endpointFailures records when fetching an endpoint last failed; reloads
+	// skip it until its retry timer fires.
+	endpointFailures map[string]time.Time
+	// endpointsFetching holds the endpoints with a fetch in progress.
+	endpointsFetching map[string]struct{}
+	// endpointTimers schedule the next fetch of endpoints with a refresh
+	// interval. It is nil after shutdown.
+	endpointTimers map[string]*time.Timer
+	// cacheDir is where endpoint schemas are cached; empty means the user
+	// cache directory.
+	cacheDir string
+	// clientCtx is the context of the latest schema reload. Reloads started
+	// in the background publish their diagnostics through it.
+	clientCtx *glsp.Context
+	index     *sourceIndex
+
+	// project is the default project. It serves every document that no named
+	// project claims and is the only project when the config has no
+	// `projects` section.
+	project
+	projects map[string]*project
 }
 
 func newState() *State {
 	return &State{
 		docs:              make(map[protocol.DocumentUri]string),
+		versions:          make(map[protocol.DocumentUri]protocol.Integer),
 		queryDiagnostics:  make(map[protocol.DocumentUri][]protocol.Diagnostic),
+		queryVersions:     make(map[protocol.DocumentUri]protocol.Integer),
 		schemaDiagnostics: make(map[protocol.DocumentUri][]protocol.Diagnostic),
-		schemaURIs:        make(map[protocol.DocumentUri]struct{}),
+		introspection:     make(map[protocol.DocumentUri]*introspectionDocument),
+		endpointFetches:   make(map[string]time.Time),
+		endpointFailures:  make(map[string]time.Time),
+		endpointsFetching: make(map[string]struct{}),
+		endpointTimers:    make(map[string]*time.Timer),
+		index:             newSourceIndex(),
+		project:           newProject(""),
+		projects:          make(map[string]*project),
+	}
+}
+
+type project struct {
+	name        string
+	config      *projectConfig
+	schemaPaths []string
+	schema      *ast.Schema
+	schemaURIs  map[protocol.DocumentUri]struct{}
+	fragments   map[string]*ast.FragmentDefinition
+	operations  []*ast.OperationDefinition
+
+	// schemaKey identifies the sources schema was last built from; reloads
+	// with the same sources reuse schema and schemaDiagnostics.
+	schemaKey         uint64
+	schemaBuilt       bool
+	schemaDiagnostics map[protocol.DocumentUri][]protocol.Diagnostic
+
+	// symbols lists the workspace symbols of symbolsSchema, rebuilt once
+	// schema is replaced.
+	symbols       []protocol.SymbolInformation
+	symbolsSchema *ast.Schema
+}
+
+func newProject(name string) project {
+	return project{
+		name:       name,
+		schemaURIs: make(map[protocol.DocumentUri]struct{}),
+		fragments:  make(map[string]*ast.FragmentDefinition),
 	}
 }
@@ -0,0 +1,520 @@
+package ls
+
+import (
+	"log/slog"
+	"sort"
+	"unicode/utf16"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/lexer"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+func (s *Server) documentSymbol(_ *glsp.Context, params *protocol.DocumentSymbolParams) (any, error) {
+	uri := params.TextDocument.URI
+	if isIntrospectionURI(uri) {
+		return nil, nil
+	}
+	text, ok := s.documentText(uri)
+	if !ok {
+		return nil, nil
+	}
+	source := &ast.Source{
+		Name:  string(uri),
+		Input: text,
+	}
+
+	if s.isSchemaURI(uri) || !isExecutableDocument(text) {
+		doc, err := parser.ParseSchema(source)
+		if err != nil {
+			slog.Debug("documentSymbol: schema parse error", "uri", uri, "error", err)
+			return nil, nil
+		}
+		return schemaDocumentSymbols(doc, newSymbolTokens(source)), nil
+	}
+
+	doc, err := parser.ParseQuery(source)
+	if err != nil {
+		slog.Debug("documentSymbol: query parse error", "uri", uri, "error", err)
+		return nil, nil
+	}
+	return queryDocumentSymbols(doc, newSymbolTokens(source)), nil
+}
+
+// symbolNode is a top-level definition whose symbol is built once the start
+// of the following definition, and so its own end, is known.
+type symbolNode struct {
+	start int
+	build func(end int) *protocol.DocumentSymbol
+}
+
+// buildSymbols orders nodes by their first token and lets each end right
+// before the next one.
+func (t *symbolTokens) buildSymbols(nodes []symbolNode) []protocol.DocumentSymbol {
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].start < nodes[j].start
+	})
+	symbols := make([]protocol.DocumentSymbol, 0, len(nodes))
+	for i, node := range nodes {
+		end := len(t.tokens) - 1
+		if i+1 < len(nodes) {
+			end = nodes[i+1].start - 1
+		}
+		if symbol := node.build(end); symbol != nil {
+			symbols = append(symbols, *symbol)
+		}
+	}
+	return symbols
+}
+
+func schemaDocumentSymbols(doc *ast.SchemaDocument, t *symbolTokens) []protocol.DocumentSymbol {
+	var nodes []symbolNode
+	addDefinition := func(def *ast.Definition, extension bool) {
+		nameIdx := t.index(def.Position)
+		if nameIdx < 1 {
+			return
+		}
+		start := nameIdx - 1
+		if extension {
+			start--
+		} else if def.Description != "" && t.isDescription(start-1) {
+			start--
+		}
+		nodes = append(nodes, symbolNode{start: start, build: func(end int) *protocol.DocumentSymbol {
+			symbol := &protocol.DocumentSymbol{
+				Name:           def.Name,
+				Kind:           symbolKindForDefinition(def),
+				Range:          t.span(start, end),
+				SelectionRange: t.span(nameIdx, nameIdx),
+			}
+			if extension {
+				detail := "extend"
+				symbol.Detail = &detail
+			}
+			switch {
+			case len(def.Fields) > 0:
+				symbol.Children = t.fieldSymbols(def.Fields)
+			case len(def.EnumValues) > 0:
+				symbol.Children = t.enumValueSymbols(def.EnumValues)
+			}
+			return symbol
+		}})
+	}
+	for _, def := range doc.Definitions {
+		addDefinition(def, false)
+	}
+	for _, def := range doc.Extensions {
+		addDefinition(def, true)
+	}
+
+	for _, def := range doc.Directives {
+		// The position points at the name after `directive @`.
+		nameIdx := t.index(def.Position)
+		if nameIdx < 2 {
+			continue
+		}
+		start := nameIdx - 2
+		if def.Description != "" && t.isDescription(start-1) {
+			start--
+		}
+		nodes = append(nodes, symbolNode{start: start, build: func(end int) *protocol.DocumentSymbol {
+			symbol := &protocol.DocumentSymbol{
+				Name:           "@" + def.Name,
+				Kind:           protocol.SymbolKindFunction,
+				Range:          t.span(start, end),
+				SelectionRange: t.span(nameIdx-1, nameIdx),
+			}
+			if t.kindAt(nameIdx+1) == lexer.ParenL {
+				symbol.Children = t.argumentSymbols(def.Arguments, t.closing(nameIdx+1))
+			}
+			return symbol
+		}})
+	}
+
+	// Schema definitions have no symbol but still bound their neighbours.
+	for _, def := range append(doc.Schema, doc.SchemaExtension...) {
+		start := t.index(def.Position) - 1
+		if def.Description != "" && t.isDescription(start-1) {
+			start--
+		} else if t.isName(start-1, "extend") {
+			start--
+		}
+		if start < 0 {
+			continue
+		}
+		nodes = append(nodes, symbolNode{start: start, build: func(int) *protocol.DocumentSymbol {
+			return nil
+		}})
+	}
+	return t.buildSymbols(nodes)
+}
+
+// fieldSymbols returns the symbols of the fields of a type, which sit in a
+// `{ }` block right after the last token of the type header.
+func (t *symbolTokens) fieldSymbols(fields ast.FieldList) []protocol.DocumentSymbol {
+	starts := make([]int, len(fields))
+	for i, field := range fields {
+		starts[i] = t.index(field.Position)
+	}
+	if starts[0] < 1 {
+		return nil
+	}
+	return t.listSymbols(starts, t.closing(starts[0]-1), func(i, start, end int) protocol.DocumentSymbol {
+		field := fields[i]
+		nameIdx := t.skipDescription(start)
+		detail := field.Type.String()
+		symbol := protocol.DocumentSymbol{
+			Name:           field.Name,
+			Detail:         &detail,
+			Kind:           protocol.SymbolKindField,
+			Tags:           symbolTags(field.Directives),
+			Range:          t.span(start, end),
+			SelectionRange: t.span(nameIdx, nameIdx),
+		}
+		if t.kindAt(nameIdx+1) == lexer.ParenL {
+			symbol.Children = t.argumentSymbols(field.Arguments, t.closing(nameIdx+1))
+		}
+		return symbol
+	})
+}
+
+func (t *symbolTokens) argumentSymbols(args ast.ArgumentDefinitionList, closing int) []protocol.DocumentSymbol {
+	starts := make([]int, len(args))
+	for i, arg := range args {
+		starts[i] = t.index(arg.Position)
+	}
+	return t.listSymbols(starts, closing, func(i, start, end int) protocol.DocumentSymbol {
+		arg := args[i]
+		nameIdx := t.skipDescription(start)
+		detail := arg.Type.String()
+		return protocol.DocumentSymbol{
+			Name:           arg.Name,
+			Detail:         &detail,
+			Kind:           protocol.SymbolKindProperty,
+			Tags:           symbolTags(arg.Directives),
+			Range:          t.span(start, end),
+			SelectionRange: t.span(nameIdx, nameIdx),
+		}
+	})
+}
+
+func (t *symbolTokens) enumValueSymbols(values ast.EnumValueList) []protocol.DocumentSymbol {
+	starts := make([]int, len(values))
+	for i, value := range values {
+		starts[i] = t.index(value.Position)
+	}
+	if starts[0] < 1 {
+		return nil
+	}
+	return t.listSymbols(starts, t.closing(starts[0]-1), func(i, start, end int) protocol.DocumentSymbol {
+		value := values[i]
+		nameIdx := t.skipDescription(start)
+		return protocol.DocumentSymbol{
+			Name:           value.Name,
+			Kind:           protocol.SymbolKindEnumMember,
+			Tags:           symbolTags(value.Directives),
+			Range:          t.span(start, end),
+			SelectionRange: t.span(nameIdx, nameIdx),
+		}
+	})
+}
+
+func queryDocumentSymbols(doc *ast.QueryDocument, t *symbolTokens) []protocol.DocumentSymbol {
+	var nodes []symbolNode
+	for _, op := range doc.Operations {
+		start := t.index(op.Position)
+		if start < 0 {
+			continue
+		}
+		nodes = append(nodes, symbolNode{start: start, build: func(end int) *protocol.DocumentSymbol {
+			detail := string(op.Operation)
+			symbol := &protocol.DocumentSymbol{
+				Name:           op.Name,
+				Detail:         &detail,
+				Kind:           protocol.SymbolKindFunction,
+				Range:          t.span(start, end),
+				SelectionRange: t.span(start, start),
+				Children:       t.selectionSymbols(op.SelectionSet, end),
+			}
+			if op.Name == "" {
+				// Anonymous operations, including the `{ ... }` shorthand,
+				// are named after their operation type.
+				symbol.Name = detail
+				symbol.Detail = nil
+			} else {
+				symbol.SelectionRange = t.span(start+1, start+1)
+			}
+			return symbol
+		}})
+	}
+	for _, def := range doc.Fragments {
+		start := t.index(def.Position)
+		if start < 0 {
+			continue
+		}
+		nodes = append(nodes, symbolNode{start: start, build: func(end int) *protocol.DocumentSymbol {
+			detail := "on " + def.TypeCondition
+			return &protocol.DocumentSymbol{
+				Name:           def.Name,
+				Detail:         &detail,
+				Kind:           protocol.SymbolKindClass,
+				Range:          t.span(start, end),
+				SelectionRange: t.span(start+1, start+1),
+				Children:       t.selectionSymbols(def.SelectionSet, end),
+			}
+		}})
+	}
+	return t.buildSymbols(nodes)
+}
+
+// selectionSymbols returns the symbols of the top-level selections of a
+// selection set whose closing brace is at closing.
+func (t *symbolTokens) selectionSymbols(set ast.SelectionSet, closing int) []protocol.DocumentSymbol {
+	starts := make([]int, len(set))
+	for i, selection := range set {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			starts[i] = t.index(selection.Position)
+		case *ast.FragmentSpread:
+			// The position points past the `...`.
+			starts[i] = t.index(selection.Position) - 1
+		case *ast.InlineFragment:
+			starts[i] = t.index(selection.Position) - 1
+		}
+	}
+	return t.listSymbols(starts, closing, func(i, start, end int) protocol.DocumentSymbol {
+		symbol := protocol.DocumentSymbol{
+			Range:          t.span(start, end),
+			SelectionRange: t.span(start, start),
+		}
+		switch selection := set[i].(type) {
+		case *ast.Field:
+			symbol.Name = selection.Alias
+			symbol.Kind = protocol.SymbolKindField
+			if selection.Alias != selection.Name {
+				symbol.Detail = &selection.Name
+				// Cover `alias: name`.
+				symbol.SelectionRange = t.span(start, start+2)
+			}
+		case *ast.FragmentSpread:
+			symbol.Name = "..." + selection.Name
+			symbol.Kind = protocol.SymbolKindClass
+			symbol.SelectionRange = t.span(start, start+1)
+		case *ast.InlineFragment:
+			symbol.Name = "..."
+			symbol.Kind = protocol.SymbolKindClass
+			if selection.TypeCondition != "" {
+				symbol.Name = "... on " + selection.TypeCondition
+				symbol.SelectionRange = t.span(start, start+2)
+			}
+		}
+		return symbol
+	})
+}
+
+func symbolKindForDefinition(def *ast.Definition) protocol.SymbolKind {
+	switch def.Kind {
+	case ast.Object:
+		return protocol.SymbolKindClass
+	case ast.Interface:
+		return protocol.SymbolKindInterface
+	case ast.Union, ast.Enum:
+		return protocol.SymbolKindEnum
+	case ast.InputObject:
+		return protocol.SymbolKindStruct
+	default:
+		return protocol.SymbolKindTypeParameter
+	}
+}
+
+func symbolTags(directives ast.DirectiveList) []protocol.SymbolTag {
+	if directives.ForName("deprecated") == nil {
+		return nil
+	}
+	return []protocol.SymbolTag{protocol.SymbolTagDeprecated}
+}
+
+// symbolTokens holds the significant tokens of a source. Symbol ranges are
+// measured in tokens so they ignore comments and whitespace between
+// definitions.
+type symbolTokens struct {
+	tokens []lexer.Token
+	// runes is the source text; token positions are rune offsets into it.
+	runes []rune
+	// lineStarts are the rune offsets at which lines start.
+	lineStarts []int
+}
+
+func newSymbolTokens(source *ast.Source) *symbolTokens {
+	t := &symbolTokens{runes: []rune(source.Input), lineStarts: []int{0}}
+	for i, r := range t.runes {
+		if r == '\n' {
+			t.lineStarts = append(t.lineStarts, i+1)
+		}
+	}
+	lex := lexer.New(source)
+	for {
+		tok, err := lex.ReadToken()
+		if err != nil || tok.Kind == lexer.EOF {
+			break
+		}
+		if tok.Kind == lexer.Comment {
+			continue
+		}
+		t.tokens = append(t.tokens, tok)
+	}
+	return t
+}
+
+// listSymbols builds a symbol for each element of a list, letting each one
+// end right before the next element or the closing bracket.
+func (t *symbolTokens) listSymbols(starts []int, closing int, build func(i, start, end int) protocol.DocumentSymbol) []protocol.DocumentSymbol {
+	symbols := make([]protocol.DocumentSymbol, 0, len(starts))
+	for i, start := range starts {
+		end := closing - 1
+		if i+1 < len(starts) {
+			end = starts[i+1] - 1
+		}
+		if start < 0 || end < start {
+			continue
+		}
+		symbols = append(symbols, build(i, start, end))
+	}
+	return symbols
+}
+
+// index returns the index of the token that starts at pos, or -1.
+func (t *symbolTokens) index(pos *ast.Position) int {
+	if pos == nil {
+		return -1
+	}
+	i := sort.Search(len(t.tokens), func(i int) bool {
+		return t.tokens[i].Pos.Start >= pos.Start
+	})
+	if i < len(t.tokens) && t.tokens[i].Pos.Start == pos.Start {
+		return i
+	}
+	return -1
+}
+
+// tokenAt returns the index of the token covering the rune offset, counting
+// the position right after it, or -1.
+func (t *symbolTokens) tokenAt(offset int) int {
+	i := sort.Search(len(t.tokens), func(i int) bool {
+		return t.tokens[i].Pos.End >= offset
+	})
+	if i < len(t.tokens) && t.tokens[i].Pos.Start <= offset {
+		return i
+	}
+	return -1
+}
+
+func (t *symbolTokens) kindAt(i int) lexer.Type {
+	if i < 0 || i >= len(t.tokens) {
+		return lexer.Invalid
+	}
+	return t.tokens[i].Kind
+}
+
+func (t *symbolTokens) isName(i int, value string) bool {
+	return t.kindAt(i) == lexer.Name && t.tokens[i].Value == value
+}
+
+func (t *symbolTokens) isDescription(i int) bool {
+	kind := t.kindAt(i)
+	return kind == lexer.String || kind == lexer.BlockString
+}
+
+// skipDescription returns the index of the name of an element starting at i.
+func (t *symbolTokens) skipDescription(i int) int {
+	if t.isDescription(i) {
+		return i + 1
+	}
+	return i
+}
+
+// closing returns the index of the bracket that closes the one at open.
+func (t *symbolTokens) closing(open int) int {
+	depth := 0
+	for i := max(open, 0); i < len(t.tokens); i++ {
+		switch t.tokens[i].Kind {
+		case lexer.BraceL, lexer.ParenL, lexer.BracketL:
+			depth++
+		case lexer.BraceR, lexer.ParenR, lexer.BracketR:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(t.tokens)
+}
+
+// opening returns the index of the bracket that the one at closing closes,
+// or -1.
+func (t *symbolTokens) opening(closing int) int {
+	depth := 0
+	for i := min(closing, len(t.tokens)-1); i >= 0; i-- {
+		switch t.tokens[i].Kind {
+		case lexer.BraceR, lexer.ParenR, lexer.BracketR:
+			depth++
+		case lexer.BraceL, lexer.ParenL, lexer.BracketL:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// outermostOpen returns the index of the outermost bracket that is still
+// open at token i, or -1.
+func (t *symbolTokens) outermostOpen(i int) int {
+	outermost := -1
+	depth := 0
+	for ; i >= 0; i-- {
+		switch t.tokens[i].Kind {
+		case lexer.BraceR, lexer.ParenR, lexer.BracketR:
+			depth++
+		case lexer.BraceL, lexer.ParenL, lexer.BracketL:
+			if depth > 0 {
+				depth--
+			} else {
+				outermost = i
+			}
+		}
+	}
+	return outermost
+}
+
+// span returns the range from the start of token first to the end of token
+// last.
+func (t *symbolTokens) span(first, last int) protocol.Range {
+	return protocol.Range{
+		Start: t.position(t.tokens[first].Pos.Start),
+		End:   t.position(t.tokens[last].Pos.End),
+	}
+}
+
+// nameLocation returns the location of token i.
+func (t *symbolTokens) nameLocation(i int) *protocol.Location {
+	return &protocol.Location{
+		URI:   protocol.DocumentUri(t.tokens[i].Pos.Src.Name),
+		Range: t.span(i, i),
+	}
+}
+
+// position converts a rune offset to an LSP position, whose character counts
+// UTF-16 code units.
+func (t *symbolTokens) position(offset int) protocol.Position {
+	line := sort.Search(len(t.lineStarts), func(i int) bool {
+		return t.lineStarts[i] > offset
+	}) - 1
+	return protocol.Position{
+		Line:      protocol.UInteger(line),
+		Character: protocol.UInteger(len(utf16.Encode(t.runes[t.lineStarts[line]:offset]))),
+	}
+}
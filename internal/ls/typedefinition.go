@@ -0,0 +1,124 @@
+package ls
+
+import (
+	"log/slog"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+func (s *Server) typeDefinition(_ *glsp.Context, params *protocol.TypeDefinitionParams) (any, error) {
+	uri := params.TextDocument.URI
+
+	schema := s.schemaForURI(uri)
+	if schema == nil {
+		slog.Debug("typeDefinition: schema not loaded", "uri", uri)
+		return nil, nil
+	}
+
+	text, ok := s.documentText(uri)
+	if !ok {
+		return nil, nil
+	}
+
+	offset, line, column := PositionToRuneOffset(text, params.Position)
+	var typeName string
+	if s.isSchemaURI(uri) {
+		if member := schemaMemberAtOffset(uri, text, offset); member != nil {
+			typeName = schemaMemberTypeName(schema, member)
+		}
+	} else {
+		doc, err := s.state.index.queryDocument(&ast.Source{Name: string(uri), Input: text})
+		if err != nil {
+			return nil, nil
+		}
+		typeName = variableDefinitionTypeName(doc, offset)
+		if typeName == "" {
+			for _, name := range queryNames(doc, schema) {
+				if name.covers(offset) {
+					typeName = queryNameTypeName(name)
+					break
+				}
+			}
+		}
+	}
+	def := schema.Types[typeName]
+	if def == nil || isBuiltInPosition(def.Position) {
+		slog.Debug("typeDefinition: type not found", "uri", uri, "line", line, "column", column, "type", typeName)
+		return nil, nil
+	}
+	loc := locationFromDefinition(def.Name, def.Position)
+	if loc == nil {
+		return nil, nil
+	}
+	slog.Debug("typeDefinition: type resolved", "uri", uri, "line", line, "column", column, "type", typeName)
+	return []protocol.Location{*loc}, nil
+}
+
+// queryNameTypeName returns the named type of what name refers to: the
+// return type of a field, the input type of an argument, input field, or
+// variable, and the enum of an enum value.
+func queryNameTypeName(name queryName) string {
+	switch name.kind {
+	case queryNameField, queryNameInputField:
+		if name.field != nil {
+			return name.field.Type.Name()
+		}
+	case queryNameArgument:
+		if name.argument != nil {
+			return name.argument.Type.Name()
+		}
+	case queryNameEnumValue:
+		if name.parent != nil && name.enumValue != nil {
+			return name.parent.Name
+		}
+	case queryNameType:
+		if name.typeDef != nil {
+			return name.typeDef.Name
+		}
+	case queryNameVariable:
+		for _, v := range name.variables {
+			if "$"+v.Variable == name.text {
+				return v.Type.Name()
+			}
+		}
+	}
+	return ""
+}
+
+// variableDefinitionTypeName returns the named type of the variable declared
+// at the rune offset.
+func variableDefinitionTypeName(doc *ast.QueryDocument, offset int) string {
+	for _, op := range doc.Operations {
+		for _, v := range op.VariableDefinitions {
+			if nameCovers(v.Position, "$"+v.Variable, offset) {
+				return v.Type.Name()
+			}
+		}
+	}
+	return ""
+}
+
+// schemaMemberTypeName returns the named type of the field, input field, or
+// argument m, or the enum declaring the enum value m.
+func schemaMemberTypeName(schema *ast.Schema, m *schemaMember) string {
+	def := schema.Types[m.typeName]
+	if def == nil {
+		return ""
+	}
+	if def.Kind == ast.Enum {
+		return def.Name
+	}
+	field := def.Fields.ForName(m.name)
+	if field == nil {
+		return ""
+	}
+	if m.argument == "" {
+		return field.Type.Name()
+	}
+	if arg := field.Arguments.ForName(m.argument); arg != nil {
+		return arg.Type.Name()
+	}
+	return ""
+}
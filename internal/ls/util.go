@@ -13,24 +13,26 @@ import (
 
 type initOptions struct {
 	SchemaPaths []string `json:"schemaPaths"`
+	// PrintWidth is the line width formatting wraps argument lists at.
+	PrintWidth int `json:"printWidth"`
 }
 
-func readInitializationOptions(options any) []string {
+func readInitializationOptions(options any) initOptions {
 	if options == nil {
-		return nil
+		return initOptions{}
 	}
 
 	data, err := json.Marshal(options)
 	if err != nil {
-		return nil
+		return initOptions{}
 	}
 
 	var decoded initOptions
 	if err := json.Unmarshal(data, &decoded); err != nil {
-		return nil
+		return initOptions{}
 	}
 
-	return decoded.SchemaPaths
+	return decoded
 }
 
 func hasFileScheme(value string) bool {
@@ -75,6 +77,9 @@ func expandSchemaPattern(root, pattern string) []string {
 		expanded = filepath.Join(root, expanded)
 	}
 
+	if strings.Contains(expanded, "**") || strings.Contains(expanded, "{") {
+		return expandRecursiveGlob(expanded)
+	}
 	if hasGlobMeta(expanded) {
 		matches, err := filepath.Glob(expanded)
 		if err != nil {
@@ -95,6 +100,12 @@ func isGraphQLFile(path string) bool {
 	return ext == ".graphql" || ext == ".graphqls"
 }
 
+// isSchemaSourceFile reports whether path may be listed as a schema source:
+// SDL files or introspection results.
+func isSchemaSourceFile(path string) bool {
+	return isGraphQLFile(path) || isIntrospectionPath(path)
+}
+
 func isSchemaPath(path string) bool {
 	ext := strings.ToLower(filepath.Ext(path))
 	if ext == ".graphqls" {
@@ -116,11 +127,13 @@ func isSchemaURI(uri protocol.DocumentUri) bool {
 }
 
 func (s *Server) isSchemaURI(uri protocol.DocumentUri) bool {
-	s.state.mu.Lock()
-	_, ok := s.state.schemaURIs[uri]
-	s.state.mu.Unlock()
-	if ok {
-		return true
+	for _, p := range s.allProjects() {
+		s.state.mu.Lock()
+		_, ok := p.schemaURIs[uri]
+		s.state.mu.Unlock()
+		if ok {
+			return true
+		}
 	}
 	return isSchemaURI(uri)
 }
@@ -189,3 +202,39 @@ func fieldSignature(field *ast.FieldDefinition) string {
 	b.WriteString(field.Type.String())
 	return b.String()
 }
+
+// namePositionAfterKeyword returns the position of the name token that
+// follows the keyword starting at pos, such as `Foo` in `fragment Foo on Bar`.
+func namePositionAfterKeyword(pos *ast.Position, keyword string) *ast.Position {
+	if pos == nil || pos.Src == nil {
+		return nil
+	}
+	runes := []rune(pos.Src.Input)
+	keywordLen := utf8.RuneCountInString(keyword)
+	i := pos.Start + keywordLen
+	line := pos.Line
+	column := pos.Column + keywordLen
+	for i < len(runes) && (runes[i] == ' ' || runes[i] == '\t' || runes[i] == ',' || runes[i] == '\r' || runes[i] == '\n') {
+		if runes[i] == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+		i++
+	}
+	start := i
+	for i < len(runes) && isNameContinue(runes[i]) {
+		i++
+	}
+	if start == i {
+		return nil
+	}
+	return &ast.Position{
+		Start:  start,
+		End:    i,
+		Line:   line,
+		Column: column,
+		Src:    pos.Src,
+	}
+}
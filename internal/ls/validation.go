@@ -0,0 +1,142 @@
+package ls
+
+import (
+	"log/slog"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/lexer"
+	"github.com/vektah/gqlparser/v2/parser"
+	"github.com/vektah/gqlparser/v2/validator"
+	"github.com/vektah/gqlparser/v2/validator/rules"
+)
+
+func (s *Server) updateQueryDiagnostics(uri protocol.DocumentUri, text string) {
+	p := s.projectForURI(uri)
+	s.state.mu.Lock()
+	schema := p.schema
+	fragments := p.fragments
+	s.state.mu.Unlock()
+
+	diagnostics := queryDiagnostics(uri, text, schema, fragments)
+	s.state.mu.Lock()
+	if current, open := s.state.docs[uri]; open && current != text {
+		// A newer version arrived meanwhile; its own run will publish.
+		s.state.mu.Unlock()
+		slog.Debug("query diagnostics discarded", "uri", uri)
+		return
+	}
+	s.state.queryDiagnostics[uri] = diagnostics
+	if version, open := s.state.versions[uri]; open {
+		s.state.queryVersions[uri] = version
+	}
+	s.state.mu.Unlock()
+	slog.Debug("query diagnostics updated", "uri", uri, "count", len(diagnostics))
+}
+
+func (s *Server) refreshOpenQueryDiagnostics() {
+	s.state.mu.Lock()
+	docs := make(map[protocol.DocumentUri]string, len(s.state.docs))
+	for uri, text := range s.state.docs {
+		docs[uri] = text
+	}
+	s.state.mu.Unlock()
+
+	for uri, text := range docs {
+		if s.isSchemaURI(uri) || isIntrospectionURI(uri) {
+			continue
+		}
+		s.updateQueryDiagnostics(uri, text)
+	}
+}
+
+func queryDiagnostics(uri protocol.DocumentUri, text string, schema *ast.Schema, fragments map[string]*ast.FragmentDefinition) []protocol.Diagnostic {
+	doc, err := parser.ParseQuery(&ast.Source{
+		Name:  string(uri),
+		Input: text,
+	})
+	if err != nil {
+		return GqlErrorDiagnostics(err)
+	}
+	if schema == nil {
+		return nil
+	}
+
+	errs := validator.ValidateWithRules(schema, withReferencedFragments(doc, fragments), documentValidationRules(doc))
+	var local gqlerror.List
+	for _, gqlErr := range errs {
+		// Errors inside fragments borrowed from other documents belong to
+		// those documents.
+		if file := gqlErrorURI(gqlErr); file != "" && file != uri {
+			continue
+		}
+		local = append(local, gqlErr)
+	}
+	if len(local) == 0 {
+		return nil
+	}
+	return expandDiagnosticRanges(text, diagnosticsFromList(local))
+}
+
+// documentValidationRules is the standard rule set for doc. Documents with
+// no operations drop NoUnusedFragments: they hold fragments shared across the
+// workspace, which are spread from other files and so never used in their
+// own. Documents with operations keep every rule.
+func documentValidationRules(doc *ast.QueryDocument) *rules.Rules {
+	r := rules.NewDefaultRules()
+	if len(doc.Operations) == 0 {
+		r.RemoveRule(rules.NoUnusedFragmentsRule.Name)
+	}
+	return r
+}
+
+// expandDiagnosticRanges widens single-character ranges reported by
+// gqlparser so they cover the name or variable token they point at.
+func expandDiagnosticRanges(text string, diagnostics []protocol.Diagnostic) []protocol.Diagnostic {
+	for i := range diagnostics {
+		r := &diagnostics[i].Range
+		lineText, ok := lineTextAt(text, int(r.Start.Line)+1)
+		if !ok {
+			continue
+		}
+		runes := []rune(lineText)
+		start := int(r.Start.Character)
+		if start >= len(runes) {
+			continue
+		}
+		end := start
+		if runes[end] == '$' {
+			end++
+		}
+		for end < len(runes) && isNameContinue(runes[end]) {
+			end++
+		}
+		if end > start {
+			r.End.Character = protocol.UInteger(end)
+		}
+	}
+	return diagnostics
+}
+
+func isExecutableDocument(text string) bool {
+	lex := lexer.New(&ast.Source{Input: text})
+	for {
+		tok, err := lex.ReadToken()
+		if err != nil {
+			return false
+		}
+		switch tok.Kind {
+		case lexer.Comment:
+			continue
+		case lexer.BraceL:
+			return true
+		case lexer.Name:
+			switch tok.Value {
+			case "query", "mutation", "subscription", "fragment":
+				return true
+			}
+		}
+		return false
+	}
+}
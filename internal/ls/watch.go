@@ -0,0 +1,120 @@
+package ls
+
+import (
+	"log/slog"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+const watchedFilesRegistrationID = "graphql-watched-files"
+
+// watchedFileGlobs cover schema sources, executable documents, and the
+// graphql-config file names.
+var watchedFileGlobs = []string{
+	"**/*.{graphql,graphqls,json}",
+	"**/.graphqlrc",
+	"**/.graphqlrc.{yaml,yml}",
+	"**/graphql.config.{yaml,yml}",
+}
+
+func (s *Server) initialized(ctx *glsp.Context, _ *protocol.InitializedParams) error {
+	s.state.mu.Lock()
+	watch := s.state.watchFiles
+	s.state.mu.Unlock()
+	if !watch || ctx == nil || ctx.Call == nil {
+		return nil
+	}
+
+	watchers := make([]protocol.FileSystemWatcher, 0, len(watchedFileGlobs))
+	for _, glob := range watchedFileGlobs {
+		watchers = append(watchers, protocol.FileSystemWatcher{GlobPattern: glob})
+	}
+	params := protocol.RegistrationParams{
+		Registrations: []protocol.Registration{{
+			ID:     watchedFilesRegistrationID,
+			Method: string(protocol.MethodWorkspaceDidChangeWatchedFiles),
+			RegisterOptions: protocol.DidChangeWatchedFilesRegistrationOptions{
+				Watchers: watchers,
+			},
+		}},
+	}
+	slog.Debug("registering file watchers", "globs", watchedFileGlobs)
+	// Call waits for the client's reply, which is not read until this
+	// notification handler returns.
+	go ctx.Call(string(protocol.ServerClientRegisterCapability), params, nil)
+	return nil
+}
+
+func (s *Server) didChangeWatchedFiles(ctx *glsp.Context, params *protocol.DidChangeWatchedFilesParams) error {
+	var changed []protocol.DocumentUri
+	for _, event := range params.Changes {
+		slog.Debug("watched file changed", "uri", event.URI, "type", event.Type)
+		s.state.index.forget(event.URI)
+		if event.Type != protocol.FileChangeTypeChanged {
+			s.state.index.invalidateScans()
+		}
+		if isConfigURI(event.URI) {
+			s.loadProjectConfig()
+			s.loadWorkspaceSchema(ctx)
+			return nil
+		}
+		s.state.mu.Lock()
+		_, open := s.state.docs[event.URI]
+		s.state.mu.Unlock()
+		if open {
+			// The editor buffer wins over the file on disk.
+			continue
+		}
+		changed = append(changed, event.URI)
+	}
+
+	projects := s.projectsAffectedBy(changed)
+	if len(projects) == 0 {
+		return nil
+	}
+	s.reloadProjectSchemas(ctx, projects)
+	return nil
+}
+
+// projectsAffectedBy returns the projects that load any of uris as schema,
+// would pick them up as new schema files, or own them as documents.
+func (s *Server) projectsAffectedBy(uris []protocol.DocumentUri) []*project {
+	s.state.mu.Lock()
+	root := s.state.rootPath
+	s.state.mu.Unlock()
+
+	var affected []*project
+	for _, p := range s.allProjects() {
+		patterns := s.schemaPatterns(p)
+		for _, uri := range uris {
+			if s.projectUsesFile(p, root, patterns, uri) {
+				affected = append(affected, p)
+				break
+			}
+		}
+	}
+	return affected
+}
+
+func (s *Server) projectUsesFile(p *project, root string, schemaPatterns []string, uri protocol.DocumentUri) bool {
+	s.state.mu.Lock()
+	_, loaded := p.schemaURIs[uri]
+	s.state.mu.Unlock()
+	if loaded {
+		return true
+	}
+	path := uriToPath(uri)
+	if path == "" || !isSchemaSourceFile(path) {
+		return false
+	}
+	if len(schemaPatterns) > 0 {
+		if matchesAnyPattern(schemaPatterns, root, path) {
+			return true
+		}
+	} else if isGraphQLFile(path) && p.name == "" && !s.hasNamedProjects() {
+		// The lone default project scans the workspace for schema files.
+		return true
+	}
+	return isGraphQLFile(path) && s.ownsDocument(p, uri)
+}
@@ -0,0 +1,190 @@
+package ls
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// maxWorkspaceSymbols caps the number of workspace/symbol results.
+const maxWorkspaceSymbols = 200
+
+type symbolMatch struct {
+	symbol protocol.SymbolInformation
+	score  int
+}
+
+func (s *Server) workspaceSymbol(_ *glsp.Context, params *protocol.WorkspaceSymbolParams) ([]protocol.SymbolInformation, error) {
+	query := strings.Join(strings.Fields(params.Query), "")
+	seen := make(map[string]struct{})
+	var matches []symbolMatch
+	for _, p := range s.allProjects() {
+		for _, symbol := range s.projectSymbols(p) {
+			score, ok := fuzzyScore(query, symbol.Name)
+			if !ok {
+				continue
+			}
+			// Projects sharing schema files report the same symbols.
+			key := symbol.Name + "\x00" + locationKey(symbol.Location)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			matches = append(matches, symbolMatch{symbol: symbol, score: score})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if len(a.symbol.Name) != len(b.symbol.Name) {
+			return len(a.symbol.Name) < len(b.symbol.Name)
+		}
+		if a.symbol.Name != b.symbol.Name {
+			return a.symbol.Name < b.symbol.Name
+		}
+		return a.symbol.Location.URI < b.symbol.Location.URI
+	})
+	if len(matches) > maxWorkspaceSymbols {
+		matches = matches[:maxWorkspaceSymbols]
+	}
+	symbols := make([]protocol.SymbolInformation, 0, len(matches))
+	for _, match := range matches {
+		symbols = append(symbols, match.symbol)
+	}
+	return symbols, nil
+}
+
+// projectSymbols returns the symbols of the loaded schema and the indexed
+// operations and fragments of p.
+func (s *Server) projectSymbols(p *project) []protocol.SymbolInformation {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	if p.symbolsSchema != p.schema {
+		p.symbols = schemaSymbols(p.schema)
+		p.symbolsSchema = p.schema
+	}
+
+	symbols := make([]protocol.SymbolInformation, 0, len(p.symbols)+len(p.operations)+len(p.fragments))
+	symbols = append(symbols, p.symbols...)
+	for _, op := range p.operations {
+		pos := namePositionAfterKeyword(op.Position, string(op.Operation))
+		symbols = appendSymbol(symbols, op.Name, protocol.SymbolKindFunction, "", locationFromDefinition(op.Name, pos), nil)
+	}
+	for _, fragment := range p.fragments {
+		symbols = appendSymbol(symbols, fragment.Name, protocol.SymbolKindClass, "", fragmentDefinitionLocation(fragment), nil)
+	}
+	return symbols
+}
+
+// schemaSymbols lists the types, fields (as `Type.field`), enum values
+// (as `Enum.VALUE`), and directives of schema, leaving out built-ins.
+func schemaSymbols(schema *ast.Schema) []protocol.SymbolInformation {
+	if schema == nil {
+		return nil
+	}
+	var symbols []protocol.SymbolInformation
+	for _, def := range schema.Types {
+		if def.BuiltIn || isBuiltInPosition(def.Position) {
+			continue
+		}
+		symbols = appendSymbol(symbols, def.Name, symbolKindForDefinition(def), "", locationFromDefinition(def.Name, def.Position), def.Directives)
+		for _, field := range def.Fields {
+			if isBuiltInPosition(field.Position) {
+				continue
+			}
+			symbols = appendSymbol(symbols, def.Name+"."+field.Name, protocol.SymbolKindField, def.Name, locationFromDefinition(field.Name, field.Position), field.Directives)
+		}
+		for _, value := range def.EnumValues {
+			symbols = appendSymbol(symbols, def.Name+"."+value.Name, protocol.SymbolKindEnumMember, def.Name, locationFromDefinition(value.Name, value.Position), value.Directives)
+		}
+	}
+	for _, directive := range schema.Directives {
+		if isBuiltInPosition(directive.Position) {
+			continue
+		}
+		symbols = appendSymbol(symbols, "@"+directive.Name, protocol.SymbolKindFunction, "", locationFromDefinition(directive.Name, directive.Position), nil)
+	}
+	return symbols
+}
+
+func appendSymbol(symbols []protocol.SymbolInformation, name string, kind protocol.SymbolKind, container string, loc *protocol.Location, directives ast.DirectiveList) []protocol.SymbolInformation {
+	if loc == nil {
+		return symbols
+	}
+	symbol := protocol.SymbolInformation{
+		Name:     name,
+		Kind:     kind,
+		Tags:     symbolTags(directives),
+		Location: *loc,
+	}
+	if container != "" {
+		symbol.ContainerName = &container
+	}
+	return append(symbols, symbol)
+}
+
+func isBuiltInPosition(pos *ast.Position) bool {
+	return pos != nil && pos.Src != nil && pos.Src.BuiltIn
+}
+
+// fuzzyScore reports whether the letters of query appear in name in order,
+// ignoring case. Exact matches of the whole name or of the part after the
+// last `.` rank first; otherwise letters that follow the previous match or
+// start a word (after `.`, `_`, `@`, or at a lower-to-upper case change)
+// score higher.
+func fuzzyScore(query, name string) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+	if strings.EqualFold(query, name) {
+		return 1 << 20, true
+	}
+	if member := name[strings.LastIndexByte(name, '.')+1:]; strings.EqualFold(query, member) {
+		return 1 << 19, true
+	}
+	want := []rune(strings.ToLower(query))
+	runes := []rune(name)
+	score := 0
+	matched := 0
+	last := -2
+	for i, r := range runes {
+		if matched == len(want) {
+			break
+		}
+		if unicode.ToLower(r) != want[matched] {
+			continue
+		}
+		score++
+		if i == last+1 {
+			score += 2
+		}
+		if isWordStart(runes, i) {
+			score += 3
+		}
+		last = i
+		matched++
+	}
+	if matched < len(want) {
+		return 0, false
+	}
+	return score, true
+}
+
+func isWordStart(runes []rune, i int) bool {
+	if i == 0 {
+		return true
+	}
+	switch prev := runes[i-1]; {
+	case prev == '.' || prev == '_' || prev == '@':
+		return true
+	default:
+		return unicode.IsUpper(runes[i]) && unicode.IsLower(prev)
+	}
+}